@@ -5,6 +5,7 @@ go 1.18
 require (
 	github.com/danieljoos/wincred v1.2.2
 	github.com/godbus/dbus/v5 v5.1.0
+	golang.org/x/crypto v0.17.0
 )
 
-require golang.org/x/sys v0.26.0 // indirect
+require golang.org/x/sys v0.26.0
@@ -1,10 +1,31 @@
 package keyring
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// provider is the active provider, selected by defaultProvider on first use
+// unless it was set before.
+var provider Keyring
+
+// defaultProvider selects the provider of the platform. It's set in the init
+// function by the relevant os file e.g.: keyring_unix.go
+var defaultProvider = func() Keyring { return fallbackServiceProvider{} }
+
+// providerMu guards provider, which SetProvider may replace at any time, and
+// the settings of the package level functions, e.g. the validator, the
+// logger and the namespace, which may be changed while other goroutines use
+// the keyring.
+var providerMu sync.RWMutex
 
-// provider set in the init function by the relevant os file e.g.:
-// keyring_unix.go
-var provider Keyring = fallbackServiceProvider{}
+// validator is called with every secret before it's stored, if set.
+var validator func(service, user, pass string) error
+
+// maxSecretLength is the maximum length of a secret in bytes, unlimited if 0.
+var maxSecretLength int
 
 var (
 	// ErrNotFound is the expected error if the secret isn't found in the
@@ -15,6 +36,34 @@ var (
 	// On Windows: The service is limited to 32KiB while the password is limited to 2560 bytes
 	// On Linux/Unix: There is no theoretical limit but performance suffers with big values (>100KiB)
 	ErrSetDataTooBig = errors.New("data passed to Set was too big")
+	// ErrMultipleMatches is returned if an attribute lookup matches more than
+	// one secret in the keyring.
+	ErrMultipleMatches = errors.New("multiple secrets match the given attributes")
+	// ErrWeakSecret is the error validators registered with SetValidator are
+	// expected to return for secrets which don't meet the policy.
+	ErrWeakSecret = errors.New("secret does not meet the password policy")
+	// ErrAlreadyExists is returned by SetIfAbsent if a secret is already
+	// stored for the service and user.
+	ErrAlreadyExists = errors.New("secret already exists in keyring")
+	// ErrUnsupported is returned if the active provider does not support the
+	// requested operation, e.g. GetModified on a backend which doesn't record
+	// modification times or Set on the read-only environment provider.
+	// Errors of unsupported features wrap it, so callers can check with
+	// errors.Is and degrade gracefully.
+	ErrUnsupported = errors.New("operation not supported by keyring provider")
+	// ErrLocked is returned if the keyring is locked and couldn't be
+	// unlocked.
+	ErrLocked = errors.New("keyring is locked")
+	// ErrPromptDismissed is returned if the user dismissed the prompt to
+	// unlock the keyring.
+	ErrPromptDismissed = errors.New("keyring unlock prompt was dismissed")
+	// ErrSecretTooLong is returned if a secret is longer than the limit set
+	// with SetMaxSecretLength. The returned error wraps it.
+	ErrSecretTooLong = errors.New("secret is too long")
+	// ErrNoSessionBus is wrapped by the errors of the Secret Service
+	// provider if there's no D-Bus session bus to connect to, or it can't be
+	// reached, e.g. on a headless server outside of a desktop session.
+	ErrNoSessionBus = errors.New("no D-Bus session bus")
 )
 
 // Keyring provides a simple set/get interface for a keyring service.
@@ -23,28 +72,485 @@ type Keyring interface {
 	Set(service, user, password string) error
 	// Get password from keyring given service and user name.
 	Get(service, user string) (string, error)
+	// SetBytes stores binary data in keyring for user.
+	SetBytes(service, user string, data []byte) error
+	// GetBytes gets binary data from keyring given service and user name.
+	GetBytes(service, user string) ([]byte, error)
+	// Exists reports whether a secret is stored for service and user,
+	// without reading it.
+	Exists(service, user string) (bool, error)
 	// Delete secret from keyring.
 	Delete(service, user string) error
 	// DeleteAll deletes all secrets for a given service
 	DeleteAll(service string) error
+	// List returns the users with a secret stored for a given service.
+	List(service string) ([]string, error)
+}
+
+// attributeKeyring is implemented by providers which can store and look up
+// secrets by arbitrary attributes in addition to service and user.
+type attributeKeyring interface {
+	SetWithAttributes(service string, attrs map[string]string, password string) error
+	GetWithAttributes(service string, attrs map[string]string) (string, error)
+	ExistsWithAttributes(service string, attrs map[string]string) (bool, error)
+	DeleteWithAttributes(service string, attrs map[string]string) error
+	Find(attrs map[string]string) ([]map[string]string, error)
+	GetAttributes(service, user string) (map[string]string, error)
+	UpdateAttributes(service, user string, attrs map[string]string) error
+}
+
+// itemAttributes returns a copy of attrs with the service attribute set,
+// unless service is empty.
+func itemAttributes(service string, attrs map[string]string) map[string]string {
+	attributes := make(map[string]string, len(attrs)+1)
+	for k, v := range attrs {
+		attributes[k] = v
+	}
+	if service != "" {
+		attributes["service"] = service
+	}
+	return attributes
+}
+
+// persister is implemented by providers which know whether their secrets
+// survive a reboot.
+type persister interface {
+	Persistent() bool
+}
+
+// sessionCloser is implemented by providers keeping a session open, which
+// is closed once the provider is replaced.
+type sessionCloser interface {
+	closeSession() error
+}
+
+// Provider returns the provider behind the package level functions. The
+// platform's provider is selected on the first call, so importing the
+// package doesn't connect to any service.
+func Provider() Keyring {
+	providerMu.RLock()
+	k := provider
+	providerMu.RUnlock()
+	if k != nil {
+		return k
+	}
+
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	if provider == nil {
+		provider = selectProvider()
+	}
+	return provider
+}
+
+// SetProvider replaces the provider behind the package level functions for
+// the whole process, e.g. with a file provider or one wrapping the platform
+// provider returned by Provider. An open Secret Service session of the
+// previous provider is closed.
+func SetProvider(k Keyring) {
+	setProvider(k)
+}
+
+// setProvider replaces the active provider, closing the session of the
+// previous one.
+func setProvider(k Keyring) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	if c, ok := provider.(sessionCloser); ok {
+		_ = c.closeSession()
+	}
+	provider = k
+}
+
+// modifiedKeyring is implemented by providers which record when a secret
+// was last changed.
+type modifiedKeyring interface {
+	GetModified(service, user string) (time.Time, error)
+}
+
+// collectionKeyring is implemented by providers whose backend groups secrets
+// into multiple collections.
+type collectionKeyring interface {
+	Collections() ([]string, error)
+	ActiveCollection() (string, error)
+}
+
+// locker is implemented by providers whose backend can be locked, so reading
+// secrets requires unlocking it again.
+type locker interface {
+	Lock() error
 }
 
-// Set password in keyring for user.
+// labelKeyring is implemented by providers which show secrets in a user
+// interface under a label.
+type labelKeyring interface {
+	SetWithLabel(service, user, password, label string) error
+}
+
+// absentSetter is implemented by providers which can check for an existing
+// secret and store a new one atomically.
+type absentSetter interface {
+	SetIfAbsent(service, user, password string) error
+}
+
+// renamer is implemented by providers which can move a secret to another
+// user without reading and storing it again.
+type renamer interface {
+	Rename(service, oldUser, newUser string) error
+}
+
+// copier is implemented by providers which can copy a secret without
+// handing it to the caller.
+type copier interface {
+	Copy(srcService, srcUser, dstService, dstUser string, overwrite bool) error
+}
+
+// Set password in keyring for user. An empty password is stored like any
+// other, and Get returns it rather than ErrNotFound, on every backend.
 func Set(service, user, password string) error {
-	return provider.Set(service, user, password)
+	return std().Set(service, user, password)
+}
+
+// SetIfAbsent stores password like Set unless a secret is already stored for
+// service and user, in which case ErrAlreadyExists is returned. Providers
+// which can't do both atomically check with Exists first.
+func SetIfAbsent(service, user, password string) error {
+	return std().SetIfAbsent(service, user, password)
+}
+
+// setIfAbsent stores pass through k unless a secret is already stored for
+// service and user, atomically if k supports it.
+func setIfAbsent(k Keyring, service, user, pass string) error {
+	if p, ok := k.(absentSetter); ok {
+		return p.SetIfAbsent(service, user, pass)
+	}
+
+	exists, err := k.Exists(service, user)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAlreadyExists
+	}
+	return k.Set(service, user, pass)
+}
+
+// GetOrSet returns the secret of service and user, or if there is none,
+// stores the secret returned by gen and returns it, e.g. to provision a token
+// on first run. It's stored with SetIfAbsent, so if a concurrent caller
+// stores a secret first, that one is returned and the generated one is
+// dropped.
+func GetOrSet(service, user string, gen func() (string, error)) (string, error) {
+	secret, err := Get(service, user)
+	if err != ErrNotFound {
+		return secret, err
+	}
+
+	secret, err = gen()
+	if err != nil {
+		return "", err
+	}
+
+	err = SetIfAbsent(service, user, secret)
+	if err == ErrAlreadyExists {
+		return Get(service, user)
+	}
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// SetWithLabel stores password like Set, shown under label instead of the
+// provider's default label in keyring user interfaces such as Seahorse or
+// Keychain Access. An empty label keeps the default.
+func SetWithLabel(service, user, password, label string) error {
+	return std().SetWithLabel(service, user, password, label)
+}
+
+// SetValidator registers fn to be called before any secret is stored. If fn
+// returns an error, usually ErrWeakSecret, the secret isn't stored and the
+// error is returned to the caller. Passing nil disables validation, which is
+// the default.
+func SetValidator(fn func(service, user, pass string) error) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	validator = fn
+}
+
+// SetMaxSecretLength makes storing secrets longer than n bytes fail with
+// ErrSecretTooLong up front, instead of with whatever error the backend
+// returns. Passing 0 removes the limit, which is the default.
+//
+// The backends limit secrets differently: the Windows Credential Manager
+// to 2560 bytes and the macOS keychain to about 3000 bytes including service
+// and user, while the Secret Service has no fixed limit but gets slow with
+// secrets larger than about 100KiB.
+func SetMaxSecretLength(n int) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	maxSecretLength = n
+}
+
+// validate checks a secret against the maximum length and the registered
+// validator.
+func validate(service, user, pass string) error {
+	providerMu.RLock()
+	limit, fn := maxSecretLength, validator
+	providerMu.RUnlock()
+
+	if limit > 0 && len(pass) > limit {
+		return fmt.Errorf("%w: %d bytes, at most %d allowed", ErrSecretTooLong, len(pass), limit)
+	}
+	if fn == nil {
+		return nil
+	}
+	return fn(service, user, pass)
+}
+
+// Persistent reports whether secrets stored by the active provider survive a
+// reboot, so applications can warn users when credentials are only kept for
+// the current session. Providers which don't report it are assumed to be
+// persistent.
+func Persistent() bool {
+	return persistent(Provider())
+}
+
+// persistent reports whether k survives a reboot.
+func persistent(k Keyring) bool {
+	if p, ok := k.(persister); ok {
+		return p.Persistent()
+	}
+	return true
 }
 
 // Get password from keyring given service and user name.
 func Get(service, user string) (string, error) {
-	return provider.Get(service, user)
+	return std().Get(service, user)
+}
+
+// SetBytes stores binary data such as keys or certificates in keyring for
+// user.
+func SetBytes(service, user string, data []byte) error {
+	return std().SetBytes(service, user, data)
+}
+
+// GetBytes gets binary data from keyring given service and user name.
+//
+// Unlike the string returned by Get, the returned slice can be overwritten
+// by the caller once it's done with the secret, to shorten the time the
+// secret stays in memory. The library wipes its own intermediate buffers, but
+// this is best effort only: copies made by the Go runtime, the D-Bus library
+// or the backend itself can't be reached.
+func GetBytes(service, user string) ([]byte, error) {
+	return std().GetBytes(service, user)
+}
+
+// wipe overwrites b with zeros, so a secret it holds doesn't linger in
+// memory until b is garbage collected.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
 }
 
-// Delete secret from keyring.
+// Delete secret from keyring. ErrNotFound is returned if there is no secret
+// for service and user, by every provider.
 func Delete(service, user string) error {
-	return provider.Delete(service, user)
+	return std().Delete(service, user)
 }
 
-// DeleteAll deletes all secrets for a given service
+// DeleteAll deletes all secrets for a given service. List returns the users
+// whose secrets it deletes, to check them first.
 func DeleteAll(service string) error {
-	return provider.DeleteAll(service)
+	return std().DeleteAll(service)
+}
+
+// DeleteAllCount deletes all secrets for a given service like DeleteAll and
+// returns how many were deleted, so cleanups which found nothing to delete
+// can be told apart. An empty service is rejected with ErrNotFound.
+// Providers which can't count deleted secrets report 0.
+func DeleteAllCount(service string) (int, error) {
+	return std().deleteAllCount(service)
+}
+
+// Exists reports whether a secret is stored for service and user. Unlike Get
+// it doesn't read the secret, which avoids decrypting it where possible.
+func Exists(service, user string) (bool, error) {
+	return std().Exists(service, user)
+}
+
+// List returns the users with a secret stored for a given service. An empty
+// slice and ErrNotFound are returned if there are none.
+func List(service string) ([]string, error) {
+	return std().List(service)
+}
+
+// Rename moves the secret of oldUser to newUser within service, e.g. when an
+// account is renamed. ErrNotFound is returned if oldUser has no secret and
+// ErrAlreadyExists if newUser has one. Providers which can't update the
+// user in place copy the secret to newUser and delete it from oldUser.
+func Rename(service, oldUser, newUser string) error {
+	return std().Rename(service, oldUser, newUser)
+}
+
+// rename moves a secret through k by copying and deleting it.
+func rename(k Keyring, service, oldUser, newUser string) error {
+	data, err := k.GetBytes(service, oldUser)
+	if err != nil {
+		return err
+	}
+
+	exists, err := k.Exists(service, newUser)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAlreadyExists
+	}
+
+	err = k.SetBytes(service, newUser, data)
+	if err != nil {
+		return err
+	}
+	return k.Delete(service, oldUser)
+}
+
+// Copy stores the secret of srcUser in srcService for dstUser in dstService
+// as well, e.g. when migrating to a new service name. ErrNotFound is
+// returned if the source has no secret. An existing secret of the
+// destination is only replaced if overwrite is set, otherwise
+// ErrAlreadyExists is returned.
+func Copy(srcService, srcUser, dstService, dstUser string, overwrite bool) error {
+	return std().Copy(srcService, srcUser, dstService, dstUser, overwrite)
+}
+
+// copySecret copies a secret through k by reading and storing it.
+func copySecret(k Keyring, srcService, srcUser, dstService, dstUser string, overwrite bool) error {
+	data, err := k.GetBytes(srcService, srcUser)
+	if err != nil {
+		return err
+	}
+
+	if !overwrite {
+		exists, err := k.Exists(dstService, dstUser)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrAlreadyExists
+		}
+	}
+
+	return k.SetBytes(dstService, dstUser, data)
+}
+
+// SetWithAttributes stores password in the keyring under service, tagged
+// with the given attributes. The user is taken from the "username"
+// attribute. The attribute functions leave out the service attribute if
+// service is empty, to work with secrets written by other libsecret based
+// tools using their own schema.
+func SetWithAttributes(service string, attrs map[string]string, password string) error {
+	return std().SetWithAttributes(service, attrs, password)
+}
+
+// GetWithAttributes gets the password of the single secret for service
+// matching all of the given attributes. ErrMultipleMatches is returned if
+// the attributes match more than one secret.
+func GetWithAttributes(service string, attrs map[string]string) (string, error) {
+	return std().GetWithAttributes(service, attrs)
+}
+
+// ExistsWithAttributes reports whether a single secret for service matches
+// all of the given attributes, without reading the secret.
+// ErrMultipleMatches is returned if the attributes match more than one
+// secret.
+func ExistsWithAttributes(service string, attrs map[string]string) (bool, error) {
+	return std().ExistsWithAttributes(service, attrs)
+}
+
+// DeleteWithAttributes deletes the single secret for service matching all of
+// the given attributes. ErrMultipleMatches is returned, and nothing is
+// deleted, if the attributes match more than one secret.
+func DeleteWithAttributes(service string, attrs map[string]string) error {
+	return std().DeleteWithAttributes(service, attrs)
+}
+
+// Find returns the attributes of all secrets matching all of the given
+// attributes. The secrets themselves aren't read. Unlike the other attribute
+// functions, there is no implicit service attribute.
+func Find(attrs map[string]string) ([]map[string]string, error) {
+	return std().Find(attrs)
+}
+
+// ListWithAttributes returns the users with a secret stored for service which
+// matches all of the given attributes, e.g. a "profile" attribute stored with
+// SetWithAttributes to group the secrets of a service. An empty slice and
+// ErrNotFound are returned if there are none, like List does.
+func ListWithAttributes(service string, attrs map[string]string) ([]string, error) {
+	in := std()
+	found, err := in.Find(itemAttributes(in.service(service), attrs))
+	if err != nil {
+		return []string{}, err
+	}
+
+	users := []string{}
+	for _, attributes := range found {
+		if user, ok := attributes["username"]; ok {
+			users = append(users, user)
+		}
+	}
+	if len(users) == 0 {
+		return users, ErrNotFound
+	}
+	return users, nil
+}
+
+// GetAttributes returns the attributes stored with the secret of service and
+// user, e.g. those given to SetWithAttributes. The secret itself isn't read.
+func GetAttributes(service, user string) (map[string]string, error) {
+	return std().GetAttributes(service, user)
+}
+
+// UpdateAttributes sets the given attributes on the secret of service and
+// user, e.g. to mark a credential as needing reauthentication, without
+// reading or rewriting the secret. Other attributes are kept, and the service
+// and username attributes identifying the secret can't be changed.
+// ErrNotFound is returned if there's no secret. A later Set replaces the
+// secret and keeps the attributes.
+func UpdateAttributes(service, user string, attrs map[string]string) error {
+	return std().UpdateAttributes(service, user, attrs)
+}
+
+// GetModified returns when the secret of service and user was last changed,
+// e.g. to remind users to rotate old passwords. It is supported by the
+// Secret Service provider on Linux and *BSD and the mock.
+func GetModified(service, user string) (time.Time, error) {
+	return std().GetModified(service, user)
+}
+
+// Collections returns the labels of the collections available to the
+// process. It is only supported by the Secret Service provider on Linux and
+// *BSD.
+func Collections() ([]string, error) {
+	return std().Collections()
+}
+
+// ActiveCollection returns the label of the collection the active provider
+// stores secrets in, e.g. to check which collection the "default" alias of
+// the Secret Service resolved to, or ErrNotFound if it doesn't exist yet. Like
+// Collections, it's supported where Capabilities includes
+// CapabilityCollections.
+func ActiveCollection() (string, error) {
+	return std().ActiveCollection()
+}
+
+// Lock locks the collection of the active provider, so the next access to
+// its secrets unlocks it again, usually prompting the user, e.g. to lock the
+// keyring right after reading sensitive secrets. Other applications using the
+// collection are affected as well. It is only supported by the Secret Service
+// provider on Linux and *BSD.
+func Lock() error {
+	return std().Lock()
 }
@@ -0,0 +1,234 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// errPassphraseRequired is returned by Import for an encrypted backup if no
+// passphrase is given.
+var errPassphraseRequired = errors.New("backup is encrypted, a passphrase is required")
+
+// BackupOption configures Export and Import.
+type BackupOption func(*backupOptions)
+
+type backupOptions struct {
+	passphrase []byte
+	overwrite  bool
+}
+
+// WithPassphrase encrypts the backup written by Export with a key derived
+// from passphrase, and decrypts the backup read by Import with it.
+func WithPassphrase(passphrase []byte) BackupOption {
+	return func(o *backupOptions) {
+		o.passphrase = passphrase
+	}
+}
+
+// WithOverwrite makes Import replace secrets which already exist instead of
+// keeping them.
+func WithOverwrite() BackupOption {
+	return func(o *backupOptions) {
+		o.overwrite = true
+	}
+}
+
+// backupRecord is a secret in a backup.
+type backupRecord struct {
+	Service string `json:"service"`
+	User    string `json:"user"`
+	Secret  []byte `json:"secret"`
+}
+
+// backup is the JSON format of a backup.
+type backup struct {
+	Items []backupRecord `json:"items"`
+}
+
+// encryptedBackup is the JSON format of a backup encrypted with a
+// passphrase. Data is the sealed JSON of the backup.
+type encryptedBackup struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// Export writes all secrets visible to the active provider to w as JSON, e.g.
+// to restore them on another machine or move them to another provider with
+// Import. The secrets are written in plain text unless WithPassphrase is
+// given. The active provider must be able to enumerate its items, otherwise
+// ErrUnsupported is returned.
+func Export(w io.Writer, opts ...BackupOption) error {
+	return exportSecrets(std(), w, opts...)
+}
+
+// Import stores the secrets of a backup written by Export read from r with
+// the active provider. Secrets which already exist are kept unless
+// WithOverwrite is given. An encrypted backup needs the passphrase it was
+// exported with.
+func Import(r io.Reader, opts ...BackupOption) error {
+	return importSecrets(std(), r, opts...)
+}
+
+// exportSecrets writes the secrets of k to w.
+func exportSecrets(k Keyring, w io.Writer, opts ...BackupOption) error {
+	var o backupOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	p, ok := k.(inventoryKeyring)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	var b backup
+	defer func() {
+		for _, record := range b.Items {
+			wipe(record.Secret)
+		}
+	}()
+
+	seen := map[[2]string]bool{}
+	err := walk(p, func(service, user string) error {
+		if seen[[2]string{service, user}] {
+			return nil
+		}
+		seen[[2]string{service, user}] = true
+
+		secret, err := k.GetBytes(service, user)
+		if err != nil {
+			return wrapError("export", service, user, err)
+		}
+		b.Items = append(b.Items, backupRecord{Service: service, User: user, Secret: secret})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	defer wipe(data)
+
+	if o.passphrase == nil {
+		_, err = w.Write(data)
+		return err
+	}
+
+	enc := encryptedBackup{Salt: make([]byte, 16)}
+	_, err = io.ReadFull(rand.Reader, enc.Salt)
+	if err != nil {
+		return err
+	}
+
+	aead, err := backupCipher(o.passphrase, enc.Salt)
+	if err != nil {
+		return err
+	}
+
+	enc.Nonce = make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, enc.Nonce)
+	if err != nil {
+		return err
+	}
+	enc.Data = aead.Seal(nil, enc.Nonce, data, nil)
+
+	return json.NewEncoder(w).Encode(enc)
+}
+
+// importSecrets stores the secrets of the backup read from r with k.
+func importSecrets(k Keyring, r io.Reader, opts ...BackupOption) error {
+	var o backupOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	defer wipe(data)
+
+	var enc encryptedBackup
+	err = json.Unmarshal(data, &enc)
+	if err != nil {
+		return err
+	}
+
+	if enc.Data != nil {
+		if o.passphrase == nil {
+			return errPassphraseRequired
+		}
+
+		aead, err := backupCipher(o.passphrase, enc.Salt)
+		if err != nil {
+			return err
+		}
+
+		plain, err := aead.Open(nil, enc.Nonce, enc.Data, nil)
+		if err != nil {
+			return errors.New("failed to decrypt backup, wrong passphrase?")
+		}
+		defer wipe(plain)
+		data = plain
+	}
+
+	var b backup
+	err = json.Unmarshal(data, &b)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, record := range b.Items {
+			wipe(record.Secret)
+		}
+	}()
+
+	for _, record := range b.Items {
+		if !o.overwrite {
+			exists, err := k.Exists(record.Service, record.User)
+			if err != nil {
+				return wrapError("import", record.Service, record.User, err)
+			}
+			if exists {
+				continue
+			}
+		}
+
+		err = validate(record.Service, record.User, string(record.Secret))
+		if err != nil {
+			return err
+		}
+		err = k.SetBytes(record.Service, record.User, record.Secret)
+		if err != nil {
+			return wrapError("import", record.Service, record.User, err)
+		}
+	}
+	return nil
+}
+
+// backupCipher returns the cipher of a backup encrypted with passphrase,
+// with the key derived like NewFileProvider does.
+func backupCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
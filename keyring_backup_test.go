@@ -0,0 +1,91 @@
+package keyring
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestExportImport tests moving secrets between providers through a backup.
+func TestExportImport(t *testing.T) {
+	src := &mockProvider{}
+
+	err := src.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = src.Set(service+"2", user, password+"2")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	for _, opts := range [][]BackupOption{nil, {WithPassphrase([]byte("passphrase"))}} {
+		var buf bytes.Buffer
+		err = exportSecrets(src, &buf, opts...)
+		if err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+
+		encrypted := len(opts) > 0
+		if encrypted == bytes.Contains(buf.Bytes(), []byte(service)) {
+			t.Errorf("Expected the backup to be encrypted: %t, got %s", encrypted, buf.String())
+		}
+
+		dst := &mockProvider{}
+		err = dst.Set(service, user, "existing")
+		if err != nil {
+			t.Errorf("Should not fail, got: %s", err)
+		}
+
+		err = importSecrets(dst, bytes.NewReader(buf.Bytes()), opts...)
+		if err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+
+		// existing secrets are kept by default
+		pw, err := dst.Get(service, user)
+		if err != nil || pw != "existing" {
+			t.Errorf("Expected the existing secret to be kept, got %s, %v", pw, err)
+		}
+
+		pw, err = dst.Get(service+"2", user)
+		if err != nil || pw != password+"2" {
+			t.Errorf("Expected password %s, got %s, %v", password+"2", pw, err)
+		}
+
+		err = importSecrets(dst, bytes.NewReader(buf.Bytes()), append(opts, WithOverwrite())...)
+		if err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+
+		pw, err = dst.Get(service, user)
+		if err != nil || pw != password {
+			t.Errorf("Expected the existing secret to be overwritten, got %s, %v", pw, err)
+		}
+	}
+}
+
+// TestImportPassphrase tests that encrypted backups need the right
+// passphrase.
+func TestImportPassphrase(t *testing.T) {
+	src := &mockProvider{}
+
+	err := src.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	var buf bytes.Buffer
+	err = exportSecrets(src, &buf, WithPassphrase([]byte("passphrase")))
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	err = importSecrets(&mockProvider{}, bytes.NewReader(buf.Bytes()))
+	assertError(t, err, errPassphraseRequired)
+
+	err = importSecrets(&mockProvider{}, bytes.NewReader(buf.Bytes()), WithPassphrase([]byte("wrong")))
+	if err == nil {
+		t.Errorf("Expected a wrong passphrase to fail")
+	}
+}
@@ -0,0 +1,315 @@
+package keyring
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ServiceErrors is returned by batch operations spanning several services. It
+// maps each service which failed to the error encountered.
+type ServiceErrors map[string]error
+
+func (e ServiceErrors) Error() string {
+	services := make([]string, 0, len(e))
+	for service := range e {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	msgs := make([]string, 0, len(services))
+	for _, service := range services {
+		msgs = append(msgs, service+": "+e[service].Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// deleteAllCounter is implemented by providers which can report how many
+// secrets DeleteAll removed.
+type deleteAllCounter interface {
+	deleteAllCount(service string) (int, error)
+}
+
+// deleteAllCount deletes all secrets of service through k and returns how
+// many were deleted, or 0 if k can't count them.
+func deleteAllCount(k Keyring, service string) (int, error) {
+	if c, ok := k.(deleteAllCounter); ok {
+		return c.deleteAllCount(service)
+	}
+	return 0, k.DeleteAll(service)
+}
+
+// multiDeleter is implemented by providers which can delete several services
+// more efficiently than one DeleteAll call per service.
+type multiDeleter interface {
+	DeleteAllMulti(services []string) (map[string]int, error)
+}
+
+// DeleteAllMulti deletes all secrets for each of the given services and
+// returns the number of secrets deleted per service. A failing service
+// doesn't abort the batch; its error is collected into the returned
+// ServiceErrors. Like DeleteAll, an empty service is rejected with
+// ErrNotFound. Providers which can't count deleted secrets report 0.
+func DeleteAllMulti(services []string) (map[string]int, error) {
+	return std().DeleteAllMulti(services)
+}
+
+// deleteAllMulti deletes the services through k, one at a time unless k can
+// delete several at once.
+func deleteAllMulti(k Keyring, services []string) (map[string]int, error) {
+	if m, ok := k.(multiDeleter); ok {
+		return m.DeleteAllMulti(services)
+	}
+
+	deleted := make(map[string]int, len(services))
+	errs := ServiceErrors{}
+
+	for _, service := range services {
+		n, err := deleteAllCount(k, service)
+		if err != nil {
+			errs[service] = err
+			continue
+		}
+		deleted[service] = n
+	}
+
+	if len(errs) > 0 {
+		return deleted, errs
+	}
+	return deleted, nil
+}
+
+// Purge deletes the secrets of every service starting with prefix, e.g. to
+// sign out of everything an application stored, and returns how many were
+// deleted. An empty prefix is rejected with ErrNotFound, like DeleteAll
+// rejects an empty service, so unrelated secrets can't be wiped by accident.
+// Services which fail to be deleted are reported in the returned
+// ServiceErrors. The active provider must be able to enumerate its items,
+// otherwise ErrUnsupported is returned.
+func Purge(prefix string) (int, error) {
+	return std().purge(prefix)
+}
+
+// PurgePreview returns the users of every service starting with prefix, the
+// secrets Purge would delete, without deleting anything, so the match can be
+// checked first. Like Purge, it rejects an empty prefix with ErrNotFound and
+// needs a provider which can enumerate its items.
+func PurgePreview(prefix string) (map[string][]string, error) {
+	return std().purgePreview(prefix)
+}
+
+// purgeMatches returns the users of the services of k starting with prefix.
+func purgeMatches(k Keyring, prefix string) (map[string][]string, error) {
+	if prefix == "" {
+		return nil, ErrNotFound
+	}
+
+	p, ok := k.(inventoryKeyring)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	items, err := p.inventory()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := map[string][]string{}
+	for _, item := range items {
+		if strings.HasPrefix(item.Service, prefix) {
+			matches[item.Service] = append(matches[item.Service], item.User)
+		}
+	}
+	return matches, nil
+}
+
+// purge deletes the services of k starting with prefix.
+func purge(k Keyring, prefix string) (int, error) {
+	matches, err := purgeMatches(k, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	services := make([]string, 0, len(matches))
+	for service := range matches {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	deleted, err := deleteAllMulti(k, services)
+
+	count := 0
+	for _, n := range deleted {
+		count += n
+	}
+	return count, err
+}
+
+// BatchError is returned by SetMany, GetMany and Migrate if an entry failed.
+// Entries are processed one user at a time and processing stops at the first
+// failure.
+type BatchError struct {
+	// Succeeded is the number of entries processed before the failure.
+	Succeeded int
+	// User is the user whose entry failed.
+	User string
+	// Err is the error encountered.
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("user %s failed after %d succeeded: %v", e.User, e.Succeeded, e.Err)
+}
+
+// Unwrap returns the error encountered.
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// manyKeyring is implemented by providers which can store or read several
+// secrets of a service more efficiently than one call per secret.
+type manyKeyring interface {
+	SetMany(service string, entries map[string]string) error
+	GetMany(service string, users []string) (map[string]string, error)
+}
+
+// SetMany stores the password of each user in entries under service. Users
+// are stored in sorted order. If one fails, a *BatchError tells how many
+// were stored before it. If the validator rejects a secret, none are stored.
+func SetMany(service string, entries map[string]string) error {
+	return std().SetMany(service, entries)
+}
+
+// GetMany gets the passwords of the given users of service, in order. Users
+// without a secret are left out of the result. If one fails, the secrets
+// read so far are returned with a *BatchError.
+func GetMany(service string, users []string) (map[string]string, error) {
+	return std().GetMany(service, users)
+}
+
+// GetAll gets the passwords of all users of service, e.g. for a sync tool.
+// The users are listed like List and their secrets read like GetMany, over a
+// single session where the provider supports it. ErrNotFound is returned if
+// the service has no secrets.
+func GetAll(service string) (map[string]string, error) {
+	in := std()
+	users, err := in.List(service)
+	if err != nil {
+		return nil, err
+	}
+	return in.GetMany(service, users)
+}
+
+// MigrateOption configures Migrate.
+type MigrateOption func(*migrateOptions)
+
+type migrateOptions struct {
+	deleteSource bool
+}
+
+// WithDeleteSource makes Migrate delete each secret from the source once
+// it's stored in the destination.
+func WithDeleteSource() MigrateOption {
+	return func(o *migrateOptions) {
+		o.deleteSource = true
+	}
+}
+
+// Migrate copies the secrets of all users of service from src to dst, e.g.
+// when switching to another provider, and returns how many were copied.
+// Secrets which already exist in dst are replaced. Users are copied in sorted
+// order; if one fails, a *BatchError tells how many were copied before it.
+// An empty source isn't an error, nothing is copied. The service is used as
+// given; the namespace set with SetNamespace only applies to the package
+// level functions.
+func Migrate(src, dst Keyring, service string, opts ...MigrateOption) (int, error) {
+	o := migrateOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	users, err := src.List(service)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(users)
+
+	migrated := 0
+	for _, user := range users {
+		err = migrate(src, dst, service, user, o.deleteSource)
+		if err == ErrNotFound {
+			// deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return migrated, &BatchError{Succeeded: migrated, User: user, Err: err}
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// migrate copies the secret of service and user from src to dst, deleting
+// it from src if deleteSource is set.
+func migrate(src, dst Keyring, service, user string, deleteSource bool) error {
+	data, err := src.GetBytes(service, user)
+	if err != nil {
+		return err
+	}
+	defer wipe(data)
+
+	err = dst.SetBytes(service, user, data)
+	if err != nil || !deleteSource {
+		return err
+	}
+	return src.Delete(service, user)
+}
+
+// getMany gets the users' secrets through k, one at a time unless k can read
+// several at once.
+func getMany(k Keyring, service string, users []string) (map[string]string, error) {
+	if p, ok := k.(manyKeyring); ok {
+		return p.GetMany(service, users)
+	}
+
+	secrets := make(map[string]string, len(users))
+	for i, user := range users {
+		secret, err := k.Get(service, user)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return secrets, &BatchError{Succeeded: i, User: user, Err: err}
+		}
+		secrets[user] = secret
+	}
+	return secrets, nil
+}
+
+// setMany stores the secrets of entries through k, one at a time in sorted
+// order unless k can store several at once.
+func setMany(k Keyring, service string, entries map[string]string) error {
+	if p, ok := k.(manyKeyring); ok {
+		return p.SetMany(service, entries)
+	}
+
+	for i, user := range sortedUsers(entries) {
+		if err := k.Set(service, user, entries[user]); err != nil {
+			return &BatchError{Succeeded: i, User: user, Err: err}
+		}
+	}
+	return nil
+}
+
+// sortedUsers returns the users of entries in sorted order.
+func sortedUsers(entries map[string]string) []string {
+	users := make([]string, 0, len(entries))
+	for user := range entries {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
@@ -0,0 +1,263 @@
+package keyring
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingDeleteProvider fails DeleteAll for a single service.
+type failingDeleteProvider struct {
+	*mockProvider
+	failService string
+	err         error
+}
+
+func (f failingDeleteProvider) deleteAllCount(service string) (int, error) {
+	if service == f.failService {
+		return 0, f.err
+	}
+	return f.mockProvider.deleteAllCount(service)
+}
+
+// TestDeleteAllMulti tests clearing several services with one failing.
+func TestDeleteAllMulti(t *testing.T) {
+	mp := &mockProvider{}
+	for _, s := range []string{"a", "b", "c"} {
+		err := mp.Set(s, user, password)
+		if err != nil {
+			t.Errorf("Should not fail, got: %s", err)
+		}
+	}
+	err := mp.Set("a", user+"2", password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	fp := failingDeleteProvider{mp, "b", errors.New("injected failure")}
+	deleted, err := deleteAllMulti(fp, []string{"a", "b", "c"})
+
+	errs, ok := err.(ServiceErrors)
+	if !ok {
+		t.Fatalf("Expected ServiceErrors, got %v", err)
+	}
+	if len(errs) != 1 || errs["b"] != fp.err {
+		t.Errorf("Expected only service b to fail, got %v", errs)
+	}
+
+	if deleted["a"] != 2 || deleted["c"] != 1 {
+		t.Errorf("Expected 2 and 1 deleted for a and c, got %v", deleted)
+	}
+	if _, ok := deleted["b"]; ok {
+		t.Errorf("Expected no count for failed service b")
+	}
+
+	_, err = mp.Get("b", user)
+	if err != nil {
+		t.Errorf("Expected secret of failed service to remain, got: %s", err)
+	}
+
+	_, err = mp.Get("c", user)
+	assertError(t, err, ErrNotFound)
+}
+
+// TestDeleteAllMultiEmptyService tests the per entry empty service guard.
+func TestDeleteAllMultiEmptyService(t *testing.T) {
+	fp := &fileProvider{path: t.TempDir() + "/keyring.json", key: func() ([]byte, error) {
+		return make([]byte, 32), nil
+	}}
+
+	err := fp.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	deleted, err := deleteAllMulti(fp, []string{"", service})
+	errs, ok := err.(ServiceErrors)
+	if !ok || errs[""] != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for the empty service, got %v", err)
+	}
+	if deleted[service] != 1 {
+		t.Errorf("Expected 1 deleted for %s, got %v", service, deleted)
+	}
+}
+
+// TestSetGetMany tests the one secret at a time fallback of SetMany and
+// GetMany.
+func TestSetGetMany(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+	MockInit()
+
+	err := SetMany(service, map[string]string{user: password, user + "2": password + "2"})
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	secrets, err := GetMany(service, []string{user, user + "2", user + "3"})
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(secrets) != 2 || secrets[user] != password || secrets[user+"2"] != password+"2" {
+		t.Errorf("Expected the secrets of %s and %s, got %v", user, user+"2", secrets)
+	}
+}
+
+// TestGetAll tests getting the secrets of all users of a service.
+func TestGetAll(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+	MockInit()
+
+	_, err := GetAll(service)
+	assertError(t, err, ErrNotFound)
+
+	err = SetMany(service, map[string]string{user: password, user + "2": password + "2"})
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	secrets, err := GetAll(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(secrets) != 2 || secrets[user] != password || secrets[user+"2"] != password+"2" {
+		t.Errorf("Expected the secrets of %s and %s, got %v", user, user+"2", secrets)
+	}
+}
+
+// TestMigrate tests copying and moving the secrets of a service between
+// providers.
+func TestMigrate(t *testing.T) {
+	src, dst := NewMockProvider(), NewMockProvider()
+
+	n, err := Migrate(src, dst, service)
+	if err != nil || n != 0 {
+		t.Errorf("Expected nothing migrated from an empty source, got %d, %v", n, err)
+	}
+
+	for _, u := range []string{user, user + "2"} {
+		if err := src.Set(service, u, password); err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+	}
+
+	n, err = Migrate(src, dst, service)
+	if err != nil || n != 2 {
+		t.Errorf("Expected 2 secrets migrated, got %d, %v", n, err)
+	}
+	if users, _ := src.List(service); len(users) != 2 {
+		t.Errorf("Expected the source to be kept, got %v", users)
+	}
+
+	n, err = Migrate(src, dst, service, WithDeleteSource())
+	if err != nil || n != 2 {
+		t.Errorf("Expected 2 secrets migrated, got %d, %v", n, err)
+	}
+	_, err = src.List(service)
+	assertError(t, err, ErrNotFound)
+
+	pw, err := dst.Get(service, user+"2")
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+
+	// the namespace of the package level functions doesn't apply
+	SetNamespace("app/")
+	defer SetNamespace("")
+	n, err = Migrate(dst, src, service)
+	if err != nil || n != 2 {
+		t.Errorf("Expected 2 secrets migrated, got %d, %v", n, err)
+	}
+	if users, _ := src.List(service); len(users) != 2 {
+		t.Errorf("Expected the secrets under the service as given, got %v", users)
+	}
+	SetNamespace("")
+
+	_, err = Migrate(dst, NewReadOnlyProvider(src), service)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Succeeded != 0 || batchErr.User != user {
+		t.Errorf("Expected a BatchError for %s, got %v", user, err)
+	}
+}
+
+// TestSetManyFailure tests that a failing Set reports how many succeeded.
+func TestSetManyFailure(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+
+	injected := errors.New("injected failure")
+	MockInitWithError(injected)
+
+	err := SetMany(service, map[string]string{"a": password, "b": password})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected a BatchError, got %v", err)
+	}
+	if batchErr.Succeeded != 0 || batchErr.User != "a" || !errors.Is(err, injected) {
+		t.Errorf("Expected user a to fail first, got %v", batchErr)
+	}
+}
+
+// TestPurge tests deleting the services with a common prefix.
+func TestPurge(t *testing.T) {
+	mp := &mockProvider{}
+	for _, s := range []string{"app-a", "app-b", "other"} {
+		err := mp.Set(s, user, password)
+		if err != nil {
+			t.Errorf("Should not fail, got: %s", err)
+		}
+	}
+	err := mp.Set("app-a", user+"2", password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	_, err = purge(mp, "")
+	assertError(t, err, ErrNotFound)
+
+	n, err := purge(mp, "app-")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 secrets deleted, got %d", n)
+	}
+
+	_, err = mp.Get("app-b", user)
+	assertError(t, err, ErrNotFound)
+
+	_, err = mp.Get("other", user)
+	if err != nil {
+		t.Errorf("Expected secret of other service to remain, got: %s", err)
+	}
+
+	_, err = purge(NewObscuredNamesProvider(mp, []byte("salt")), "app-")
+	assertError(t, err, ErrUnsupported)
+}
+
+// TestPurgeMatches tests previewing the secrets Purge would delete.
+func TestPurgeMatches(t *testing.T) {
+	mp := &mockProvider{}
+	for _, s := range []string{"app-a", "app-b", "other"} {
+		err := mp.Set(s, user, password)
+		if err != nil {
+			t.Errorf("Should not fail, got: %s", err)
+		}
+	}
+
+	_, err := purgeMatches(mp, "")
+	assertError(t, err, ErrNotFound)
+
+	matches, err := purgeMatches(mp, "app-")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(matches) != 2 || len(matches["app-a"]) != 1 || matches["app-b"][0] != user {
+		t.Errorf("Expected the users of app-a and app-b, got %v", matches)
+	}
+
+	_, err = mp.Get("app-a", user)
+	if err != nil {
+		t.Errorf("Expected the secret to remain, got: %s", err)
+	}
+}
@@ -0,0 +1,227 @@
+package keyring
+
+import (
+	"sync"
+	"time"
+)
+
+// cacheNegativeTTL is the longest time a missing secret is remembered, so a
+// secret stored elsewhere, e.g. by another process, is soon found.
+const cacheNegativeTTL = time.Second
+
+// clock returns the current time, replaced in tests.
+var clock = time.Now
+
+// cacheEntry is a remembered result of reading a secret, either the secret
+// or ErrNotFound.
+type cacheEntry struct {
+	data    []byte
+	err     error
+	expires time.Time
+}
+
+// cacheKey identifies the secret of a service and user.
+type cacheKey struct {
+	service, user string
+}
+
+// cachedProvider remembers the secrets read from an underlying keyring for
+// a while.
+type cachedProvider struct {
+	keyring Keyring
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+	// generation is increased by every write, so a read which raced with it
+	// isn't remembered.
+	generation uint64
+}
+
+// cacheFlusher is implemented by providers remembering secrets.
+type cacheFlusher interface {
+	flush()
+}
+
+// NewCachedProvider returns a Keyring which remembers the secrets read from
+// k for ttl, e.g. for CLIs reading the same token many times per run. A
+// missing secret is remembered for at most a second. Storing or deleting a
+// secret through the provider forgets it, but changes made elsewhere, e.g. by
+// another process, are only seen once the remembered secret expires.
+//
+// Secrets stay in memory while they're remembered. FlushCache forgets them
+// early.
+func NewCachedProvider(k Keyring, ttl time.Duration) Keyring {
+	return &cachedProvider{
+		keyring: k,
+		ttl:     ttl,
+		entries: map[cacheKey]cacheEntry{},
+	}
+}
+
+// FlushCache forgets the secrets remembered by the active provider if it was
+// returned by NewCachedProvider, e.g. after secrets were changed by another
+// process. Otherwise it does nothing.
+func FlushCache() {
+	if c, ok := Provider().(cacheFlusher); ok {
+		c.flush()
+	}
+}
+
+// Describe returns the provider chain with the time to live.
+func (c *cachedProvider) Describe() []ProviderInfo {
+	info := ProviderInfo{Name: "cached", Config: map[string]string{"ttl": c.ttl.String()}}
+	return append([]ProviderInfo{info}, describe(c.keyring)...)
+}
+
+// Persistent reports whether the underlying keyring survives a reboot.
+func (c *cachedProvider) Persistent() bool {
+	return persistent(c.keyring)
+}
+
+// flush forgets all remembered secrets.
+func (c *cachedProvider) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.entries {
+		wipe(entry.data)
+		delete(c.entries, key)
+	}
+	c.generation++
+}
+
+// forget forgets the secret of service and user, or of all users of service
+// if all is set, once the write fn is done.
+func (c *cachedProvider) forget(service, user string, all bool, fn func() error) error {
+	err := fn()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.entries {
+		if key.service == service && (all || key.user == user) {
+			wipe(entry.data)
+			delete(c.entries, key)
+		}
+	}
+	c.generation++
+	return err
+}
+
+// get returns the secret of service and user, remembered or read from the
+// underlying keyring. The returned slice is owned by the caller.
+func (c *cachedProvider) get(service, user string) ([]byte, error) {
+	key := cacheKey{service, user}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && clock().Before(entry.expires) {
+		c.mu.Unlock()
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		return append([]byte(nil), entry.data...), nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	data, err := c.keyring.GetBytes(service, user)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+
+	ttl := c.ttl
+	if err == ErrNotFound && ttl > cacheNegativeTTL {
+		ttl = cacheNegativeTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == generation {
+		if old, ok := c.entries[key]; ok {
+			wipe(old.data)
+		}
+		c.entries[key] = cacheEntry{
+			data:    append([]byte(nil), data...),
+			err:     err,
+			expires: clock().Add(ttl),
+		}
+	}
+	return data, err
+}
+
+// Set stores user and pass in the keyring under the defined service name.
+func (c *cachedProvider) Set(service, user, pass string) error {
+	return c.forget(service, user, false, func() error {
+		return c.keyring.Set(service, user, pass)
+	})
+}
+
+// Get gets a secret from the keyring given a service name and a user.
+func (c *cachedProvider) Get(service, user string) (string, error) {
+	data, err := c.get(service, user)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(data)
+
+	return string(data), nil
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (c *cachedProvider) SetBytes(service, user string, data []byte) error {
+	return c.forget(service, user, false, func() error {
+		return c.keyring.SetBytes(service, user, data)
+	})
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (c *cachedProvider) GetBytes(service, user string) ([]byte, error) {
+	return c.get(service, user)
+}
+
+// Exists reports whether a secret is stored for service and user, answered
+// from a remembered secret if there is one.
+func (c *cachedProvider) Exists(service, user string) (bool, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[cacheKey{service, user}]
+	c.mu.Unlock()
+	if ok && clock().Before(entry.expires) {
+		return entry.err == nil, nil
+	}
+
+	return c.keyring.Exists(service, user)
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring.
+func (c *cachedProvider) Delete(service, user string) error {
+	return c.forget(service, user, false, func() error {
+		return c.keyring.Delete(service, user)
+	})
+}
+
+// DeleteAll deletes all secrets for a given service
+func (c *cachedProvider) DeleteAll(service string) error {
+	return c.forget(service, "", true, func() error {
+		return c.keyring.DeleteAll(service)
+	})
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted.
+func (c *cachedProvider) deleteAllCount(service string) (int, error) {
+	var n int
+	err := c.forget(service, "", true, func() (err error) {
+		n, err = deleteAllCount(c.keyring, service)
+		return err
+	})
+	return n, err
+}
+
+// List returns the users with a secret stored for a given service.
+func (c *cachedProvider) List(service string) ([]string, error) {
+	return c.keyring.List(service)
+}
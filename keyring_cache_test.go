@@ -0,0 +1,61 @@
+package keyring
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCachedProvider tests remembering secrets until they expire or are
+// changed through the provider.
+func TestCachedProvider(t *testing.T) {
+	old := clock
+	defer func() { clock = old }()
+	now := time.Now()
+	clock = func() time.Time { return now }
+
+	mp := &mockProvider{}
+	cp := NewCachedProvider(mp, time.Minute)
+
+	expect := func(expected string, expectedErr error) {
+		t.Helper()
+		pw, err := cp.Get(service, user)
+		if err != expectedErr || pw != expected {
+			t.Errorf("Expected %q, %v, got %q, %v", expected, expectedErr, pw, err)
+		}
+	}
+
+	// missing secrets are only remembered briefly
+	expect("", ErrNotFound)
+	_ = mp.Set(service, user, password)
+	expect("", ErrNotFound)
+	now = now.Add(cacheNegativeTTL)
+	expect(password, nil)
+
+	// changes elsewhere are seen once the secret expires
+	_ = mp.Set(service, user, password+"2")
+	expect(password, nil)
+	now = now.Add(time.Minute)
+	expect(password+"2", nil)
+
+	// changes through the provider are seen right away
+	err := cp.Set(service, user, password+"3")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	expect(password+"3", nil)
+
+	err = cp.DeleteAll(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	expect("", ErrNotFound)
+
+	// flushing the active provider
+	oldProvider := provider
+	defer func() { provider = oldProvider }()
+	provider = cp
+
+	_ = mp.Set(service, user, password)
+	FlushCache()
+	expect(password, nil)
+}
@@ -0,0 +1,57 @@
+package keyring
+
+import "strings"
+
+// NameCodec maps a service and user to the single key some backends store a
+// secret under, and back. Selecting the codec another tool uses lets
+// go-keyring read and write that tool's secrets.
+type NameCodec interface {
+	// Encode returns the key for service and user.
+	Encode(service, user string) string
+	// Decode recovers service and user from a key. ok is false if the key
+	// wasn't produced by the codec.
+	Decode(key string) (service, user string, ok bool)
+}
+
+var (
+	// ColonNameCodec joins service and user as "service:user", the scheme
+	// go-keyring uses by default. Decoding splits at the first colon, so it
+	// is ambiguous for services containing a colon.
+	ColonNameCodec NameCodec = separatorCodec{sep: ":"}
+	// SlashNameCodec joins service and user as "service/user", the path
+	// layout of pass and similar file based stores.
+	SlashNameCodec NameCodec = separatorCodec{sep: "/"}
+	// AtNameCodec joins service and user as "user@service", the compound
+	// target name Python's keyring uses on Windows.
+	AtNameCodec NameCodec = separatorCodec{sep: "@", userFirst: true}
+)
+
+// separatorCodec joins service and user with a separator.
+type separatorCodec struct {
+	sep       string
+	userFirst bool
+}
+
+func (c separatorCodec) Encode(service, user string) string {
+	if c.userFirst {
+		return user + c.sep + service
+	}
+	return service + c.sep + user
+}
+
+func (c separatorCodec) Decode(key string) (string, string, bool) {
+	if c.userFirst {
+		// the service is a host name or similar, the user may contain the separator
+		i := strings.LastIndex(key, c.sep)
+		if i < 0 {
+			return "", "", false
+		}
+		return key[i+len(c.sep):], key[:i], true
+	}
+
+	i := strings.Index(key, c.sep)
+	if i < 0 {
+		return "", "", false
+	}
+	return key[:i], key[i+len(c.sep):], true
+}
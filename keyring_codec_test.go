@@ -0,0 +1,42 @@
+package keyring
+
+import "testing"
+
+// TestNameCodecs tests encoding and decoding keys with the built-in codecs.
+func TestNameCodecs(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec NameCodec
+		key   string
+	}{
+		{"colon", ColonNameCodec, "test-service:test-user"},
+		{"slash", SlashNameCodec, "test-service/test-user"},
+		{"at", AtNameCodec, "test-user@test-service"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key := test.codec.Encode(service, user); key != test.key {
+				t.Errorf("Expected key %s, got %s", test.key, key)
+			}
+
+			s, u, ok := test.codec.Decode(test.key)
+			if !ok || s != service || u != user {
+				t.Errorf("Expected %s and %s, got %s and %s (%v)", service, user, s, u, ok)
+			}
+
+			_, _, ok = test.codec.Decode("no separator")
+			if ok {
+				t.Errorf("Expected decoding a foreign key to fail")
+			}
+		})
+	}
+}
+
+// TestAtNameCodecUserWithAt tests decoding an email address as user.
+func TestAtNameCodecUserWithAt(t *testing.T) {
+	s, u, ok := AtNameCodec.Decode("me@example.com@github.com")
+	if !ok || s != "github.com" || u != "me@example.com" {
+		t.Errorf("Expected github.com and me@example.com, got %s and %s (%v)", s, u, ok)
+	}
+}
@@ -0,0 +1,256 @@
+package keyring
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// gitServicePrefix and dockerServicePrefix start the services of the
+	// credentials stored by RunCredentialHelper, followed by the URL.
+	gitServicePrefix    = "git:"
+	dockerServicePrefix = "docker:"
+)
+
+// errCredentialsNotFound is returned by the docker get command for unknown
+// servers. Docker looks for this exact message.
+var errCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// dockerCredentials is the JSON format of the docker credential helper
+// protocol.
+type dockerCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// RunCredentialHelper runs the credential helper command args[0] of git or
+// docker, reading the request from in and writing the response to out. The
+// credentials are stored with the active provider. A program passing its
+// arguments and stdin and stdout can be used as git-credential-<name> or
+// docker-credential-<name>.
+//
+// git and docker both send get, store and erase commands, which are told
+// apart by the request: git sends key=value lines, while docker sends the
+// server URL for get and erase and a JSON object for store. list is only
+// sent by docker. Docker expects errors to be printed to stdout, followed by
+// exiting with a non-zero status.
+//
+// git's erase only deletes the credential of the given user, and only if the
+// password matches when one is given. A stored credential containing a
+// newline or NUL byte is refused by get rather than written, since it would
+// break up the response. docker's store replaces the credentials of the
+// server, storing the new one before deleting the others.
+func RunCredentialHelper(args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: credential helper get|store|erase|list")
+	}
+
+	if args[0] == "list" {
+		return dockerList(out)
+	}
+
+	request, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	if !isGitRequest(request) {
+		return runDockerHelper(args[0], request, out)
+	}
+
+	attrs := parseGitCredential(request)
+	service := gitService(attrs)
+
+	switch args[0] {
+	case "get":
+		user := attrs["username"]
+		if user == "" {
+			users, err := List(service)
+			if err == ErrNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			user = users[0]
+		}
+
+		password, err := Get(service, user)
+		if err == ErrNotFound {
+			// git tries the next helper if nothing is returned
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// either would end the line and let the rest pass as another
+		// attribute
+		if strings.ContainsAny(user+password, "\n\x00") {
+			return fmt.Errorf("credential of %s contains a newline or NUL byte", service)
+		}
+		_, err = fmt.Fprintf(out, "username=%s\npassword=%s\n", user, password)
+		return err
+	case "store":
+		if attrs["username"] == "" || attrs["password"] == "" {
+			return nil
+		}
+		return Set(service, attrs["username"], attrs["password"])
+	case "erase":
+		return gitErase(service, attrs)
+	default:
+		// git ignores unknown commands for forward compatibility
+		return nil
+	}
+}
+
+// gitErase deletes the credential of service matching the username and, if
+// given, the password in attrs. Nothing is deleted without a username, so a
+// request for a host can't erase the credentials of all its users.
+func gitErase(service string, attrs map[string]string) error {
+	user := attrs["username"]
+	if user == "" {
+		return nil
+	}
+
+	if attrs["password"] != "" {
+		password, err := Get(service, user)
+		if err == ErrNotFound || (err == nil && password != attrs["password"]) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err := Delete(service, user)
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// isGitRequest reports whether request is in the key=value format of git
+// rather than one of the formats of docker.
+func isGitRequest(request []byte) bool {
+	trimmed := bytes.TrimSpace(request)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return false
+	}
+	return bytes.Contains(trimmed, []byte("="))
+}
+
+// parseGitCredential parses the key=value lines of a git credential request.
+func parseGitCredential(request []byte) map[string]string {
+	attrs := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(request))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			attrs[key] = value
+		}
+	}
+	return attrs
+}
+
+// gitService returns the service of the credentials for the URL in attrs.
+func gitService(attrs map[string]string) string {
+	service := gitServicePrefix + attrs["protocol"] + "://" + attrs["host"]
+	if attrs["path"] != "" {
+		service += "/" + attrs["path"]
+	}
+	return service
+}
+
+// runDockerHelper runs the docker credential helper command with request.
+func runDockerHelper(command string, request []byte, out io.Writer) error {
+	switch command {
+	case "get":
+		serverURL := strings.TrimSpace(string(request))
+		service := dockerServicePrefix + serverURL
+
+		users, err := List(service)
+		if err == ErrNotFound {
+			return errCredentialsNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		secret, err := Get(service, users[0])
+		if err == ErrNotFound {
+			return errCredentialsNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(out).Encode(dockerCredentials{
+			ServerURL: serverURL,
+			Username:  users[0],
+			Secret:    secret,
+		})
+	case "store":
+		var creds dockerCredentials
+		err := json.Unmarshal(request, &creds)
+		if err != nil {
+			return err
+		}
+
+		// a server has a single set of credentials; the new one is stored
+		// before the others are deleted, so the server is never left
+		// without one
+		service := dockerServicePrefix + creds.ServerURL
+		users, err := List(service)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		err = Set(service, creds.Username, creds.Secret)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if user == creds.Username {
+				continue
+			}
+			err = Delete(service, user)
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	case "erase":
+		err := DeleteAll(dockerServicePrefix + strings.TrimSpace(string(request)))
+		if err == ErrNotFound {
+			return errCredentialsNotFound
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown credential helper command %q", command)
+	}
+}
+
+// dockerList writes the server URLs and user names of all docker
+// credentials to out, which requires a provider that can enumerate its
+// items.
+func dockerList(out io.Writer) error {
+	items, err := std().inventory()
+	if err != nil {
+		return err
+	}
+
+	servers := map[string]string{}
+	for _, item := range items {
+		if strings.HasPrefix(item.Service, dockerServicePrefix) {
+			servers[strings.TrimPrefix(item.Service, dockerServicePrefix)] = item.User
+		}
+	}
+	return json.NewEncoder(out).Encode(servers)
+}
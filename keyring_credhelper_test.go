@@ -0,0 +1,132 @@
+package keyring
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// runHelper runs the credential helper command with request and returns its
+// output.
+func runHelper(t *testing.T, command, request string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	err := RunCredentialHelper([]string{command}, strings.NewReader(request), &out)
+	return out.String(), err
+}
+
+// TestGitCredentialHelper tests the git credential helper protocol.
+func TestGitCredentialHelper(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+	MockInit()
+
+	request := "protocol=https\nhost=example.com\n"
+
+	out, err := runHelper(t, "get", request+"\n")
+	if err != nil || out != "" {
+		t.Errorf("Expected no credentials, got %q, %v", out, err)
+	}
+
+	_, err = runHelper(t, "store", request+"username=bob\npassword=secret\n\n")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	out, err = runHelper(t, "get", request+"\n")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if out != "username=bob\npassword=secret\n" {
+		t.Errorf("Expected the credentials of bob, got %q", out)
+	}
+
+	_, err = runHelper(t, "store", request+"username=alice\npassword=secret2\n\n")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	// neither a request without username nor one with another password
+	// erases anything
+	for _, erase := range []string{request, request + "username=bob\npassword=old\n"} {
+		_, err = runHelper(t, "erase", erase)
+		if err != nil {
+			t.Errorf("Should not fail, got: %s", err)
+		}
+	}
+	users, err := List(gitServicePrefix + "https://example.com")
+	if err != nil || len(users) != 2 {
+		t.Errorf("Expected the credentials of bob and alice to be kept, got %v, %v", users, err)
+	}
+
+	_, err = runHelper(t, "erase", request+"username=bob\npassword=secret\n")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	out, err = runHelper(t, "get", request+"username=bob\n")
+	if err != nil || out != "" {
+		t.Errorf("Expected no credentials, got %q, %v", out, err)
+	}
+
+	// a newline in the secret would inject another attribute
+	err = Set(gitServicePrefix+"https://example.com", "eve", "secret\nusername=mallory")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	out, err = runHelper(t, "get", request+"username=eve\n")
+	if err == nil || out != "" {
+		t.Errorf("Expected the credential to be refused, got %q, %v", out, err)
+	}
+}
+
+// TestDockerCredentialHelper tests the docker credential helper protocol.
+func TestDockerCredentialHelper(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+	MockInit()
+
+	_, err := runHelper(t, "get", "https://registry.example.com\n")
+	assertError(t, err, errCredentialsNotFound)
+
+	_, err = runHelper(t, "store", `{"ServerURL":"https://registry.example.com","Username":"bob","Secret":"secret"}`)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	out, err := runHelper(t, "get", "https://registry.example.com\n")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	expected := `{"ServerURL":"https://registry.example.com","Username":"bob","Secret":"secret"}` + "\n"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+
+	// storing other credentials for the server replaces them
+	_, err = runHelper(t, "store", `{"ServerURL":"https://registry.example.com","Username":"alice","Secret":"secret2"}`)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	users, err := List(dockerServicePrefix + "https://registry.example.com")
+	if err != nil || len(users) != 1 || users[0] != "alice" {
+		t.Errorf("Expected only the credentials of alice, got %v, %v", users, err)
+	}
+
+	out, err = runHelper(t, "list", "")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if out != `{"https://registry.example.com":"alice"}`+"\n" {
+		t.Errorf("Expected alice to be listed, got %q", out)
+	}
+
+	_, err = runHelper(t, "erase", "https://registry.example.com\n")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	_, err = runHelper(t, "get", "https://registry.example.com\n")
+	assertError(t, err, errCredentialsNotFound)
+}
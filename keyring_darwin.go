@@ -39,6 +39,16 @@ type macOSXKeychain struct{}
 // 	return exec.Command(execPathKeychain).Run() != exec.ErrNotFound
 // }
 
+// Describe returns the provider.
+func (k macOSXKeychain) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "keychain"}}
+}
+
+// Persistent reports that keychain items survive a reboot.
+func (k macOSXKeychain) Persistent() bool {
+	return true
+}
+
 // Get password from macos keyring given service and user name.
 func (k macOSXKeychain) Get(service, username string) (string, error) {
 	out, err := exec.Command(
@@ -46,6 +56,7 @@ func (k macOSXKeychain) Get(service, username string) (string, error) {
 		"find-generic-password",
 		"-s", service,
 		"-wa", username).CombinedOutput()
+	defer wipe(out)
 	if err != nil {
 		if strings.Contains(string(out), "could not be found") {
 			err = ErrNotFound
@@ -53,13 +64,54 @@ func (k macOSXKeychain) Get(service, username string) (string, error) {
 		return "", err
 	}
 
+	return decodePassword(out)
+}
+
+// Exists reports whether a password is stored for service and user. The
+// password isn't printed, so no access prompt is shown.
+func (k macOSXKeychain) Exists(service, username string) (bool, error) {
+	out, err := exec.Command(
+		execPathKeychain,
+		"find-generic-password",
+		"-s", service,
+		"-a", username).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "could not be found") {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetBytes stores binary data in the macos keyring given a service name and
+// a user. Set base64 encodes all passwords, so any bytes round-trip.
+func (k macOSXKeychain) SetBytes(service, username string, data []byte) error {
+	return k.Set(service, username, string(data))
+}
+
+// GetBytes gets binary data from the macos keyring given service and user
+// name.
+func (k macOSXKeychain) GetBytes(service, username string) ([]byte, error) {
+	secret, err := k.Get(service, username)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(secret), nil
+}
+
+// decodePassword decodes the password printed by the security binary.
+func decodePassword(out []byte) (string, error) {
 	trimStr := strings.TrimSpace(string(out[:]))
 	// if the string has the well-known prefix, assume it's encoded
 	if strings.HasPrefix(trimStr, encodingPrefix) {
 		dec, err := hex.DecodeString(trimStr[len(encodingPrefix):])
+		defer wipe(dec)
 		return string(dec), err
 	} else if strings.HasPrefix(trimStr, base64EncodingPrefix) {
 		dec, err := base64.StdEncoding.DecodeString(trimStr[len(base64EncodingPrefix):])
+		defer wipe(dec)
 		return string(dec), err
 	}
 
@@ -68,11 +120,34 @@ func (k macOSXKeychain) Get(service, username string) (string, error) {
 
 // Set stores a secret in the macos keyring given a service name and a user.
 func (k macOSXKeychain) Set(service, username, password string) error {
+	return k.SetWithLabel(service, username, password, "")
+}
+
+// SetWithLabel stores a secret in the macos keyring given a service name and
+// a user, shown under label in Keychain Access. The keychain defaults to the
+// service name if label is empty.
+func (k macOSXKeychain) SetWithLabel(service, username, password, label string) error {
 	// if the added secret has multiple lines or some non ascii,
 	// osx will hex encode it on return. To avoid getting garbage, we
 	// encode all passwords
 	password = base64EncodingPrefix + base64.StdEncoding.EncodeToString([]byte(password))
 
+	labelArg := ""
+	if label != "" {
+		labelArg = "-l " + shellescape.Quote(label) + " "
+	}
+
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s %s-w %s\n", shellescape.Quote(service), shellescape.Quote(username), labelArg, shellescape.Quote(password))
+	return runInteractive(command)
+}
+
+// runInteractive runs a single command in the interactive mode of the
+// security binary, keeping the password out of the process arguments.
+func runInteractive(command string) error {
+	if len(command) > 4096 {
+		return ErrSetDataTooBig
+	}
+
 	cmd := exec.Command(execPathKeychain, "-i")
 	stdIn, err := cmd.StdinPipe()
 	if err != nil {
@@ -83,11 +158,6 @@ func (k macOSXKeychain) Set(service, username, password string) error {
 		return err
 	}
 
-	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", shellescape.Quote(service), shellescape.Quote(username), shellescape.Quote(password))
-	if len(command) > 4096 {
-		return ErrSetDataTooBig
-	}
-
 	if _, err := io.WriteString(stdIn, command); err != nil {
 		return err
 	}
@@ -113,28 +183,134 @@ func (k macOSXKeychain) Delete(service, username string) error {
 	return err
 }
 
+// List returns the users with a secret stored for a given service.
+func (k macOSXKeychain) List(service string) ([]string, error) {
+	items, err := dumpKeychain()
+	if err != nil {
+		return []string{}, err
+	}
+
+	users := []string{}
+	for _, item := range items {
+		if item.class == "genp" && item.attributes["svce"] == service {
+			users = append(users, item.attributes["acct"])
+		}
+	}
+
+	if len(users) == 0 {
+		return users, ErrNotFound
+	}
+	return users, nil
+}
+
+// keychainItem holds the class and attributes of a keychain item.
+type keychainItem struct {
+	class      string
+	attributes map[string]string
+}
+
+// dumpKeychain returns the attributes of all items in the default keychain
+// search list. Secrets aren't read.
+func dumpKeychain() ([]keychainItem, error) {
+	out, err := exec.Command(execPathKeychain, "dump-keychain").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDumpKeychain(out), nil
+}
+
+// parseDumpKeychain parses the output of dump-keychain, which prints every
+// item as a block starting with a keychain line:
+//
+//	keychain: "/Users/anon/Library/Keychains/login.keychain-db"
+//	class: "genp"
+//	attributes:
+//	    "acct"<blob>="anon"
+//	    "svce"<blob>=0x6D792D617070  "my-app"
+func parseDumpKeychain(out []byte) []keychainItem {
+	items := []keychainItem{}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "keychain: "):
+			items = append(items, keychainItem{attributes: map[string]string{}})
+		case len(items) == 0:
+			continue
+		case strings.HasPrefix(line, "class: "):
+			items[len(items)-1].class = strings.Trim(strings.TrimPrefix(line, "class: "), `"`)
+		case strings.HasPrefix(line, `"`):
+			if name, value, ok := parseKeychainAttribute(line); ok {
+				items[len(items)-1].attributes[name] = value
+			}
+		}
+	}
+	return items
+}
+
+// parseKeychainAttribute parses a "name"<type>=value attribute line. Values
+// are either quoted or hex encoded, in which case a quoted rendering may
+// follow. Hex encoded blobs are decoded, other hex values are kept as is.
+func parseKeychainAttribute(line string) (string, string, bool) {
+	end := strings.Index(line[1:], `"`)
+	if end < 0 {
+		return "", "", false
+	}
+	name := line[1 : end+1]
+
+	eq := strings.Index(line, ">=")
+	if eq < 0 {
+		return "", "", false
+	}
+	value := line[eq+2:]
+
+	switch {
+	case strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) && len(value) >= 2:
+		return name, value[1 : len(value)-1], true
+	case strings.HasPrefix(value, "0x"):
+		raw := strings.Fields(value)[0]
+		if strings.Contains(line[:eq], "<blob>") {
+			dec, err := hex.DecodeString(raw[2:])
+			if err != nil {
+				return "", "", false
+			}
+			return name, string(dec), true
+		}
+		return name, raw, true
+	}
+
+	return "", "", false
+}
+
 // DeleteAll deletes all secrets for a given service
 func (k macOSXKeychain) DeleteAll(service string) error {
+	_, err := k.deleteAllCount(service)
+	return err
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted.
+func (k macOSXKeychain) deleteAllCount(service string) (int, error) {
 	// if service is empty, do nothing otherwise it might accidentally delete all secrets
 	if service == "" {
-		return ErrNotFound
+		return 0, ErrNotFound
 	}
 	// Delete each secret in a while loop until there is no more left
 	// under the service
-	for {
+	for deleted := 0; ; deleted++ {
 		out, err := exec.Command(
 			execPathKeychain,
 			"delete-generic-password",
 			"-s", service).CombinedOutput()
 		if strings.Contains(string(out), "could not be found") {
-			return nil
+			return deleted, nil
 		} else if err != nil {
-			return err
+			return deleted, err
 		}
 	}
-
 }
 
 func init() {
-	provider = macOSXKeychain{}
+	defaultProvider = func() Keyring { return macOSXKeychain{} }
+	backends["keychain"] = func() Keyring { return macOSXKeychain{} }
 }
@@ -0,0 +1,47 @@
+package keyring
+
+import "testing"
+
+// TestParseDumpKeychain tests parsing quoted and hex encoded attributes.
+func TestParseDumpKeychain(t *testing.T) {
+	out := []byte(`keychain: "/Users/anon/Library/Keychains/login.keychain-db"
+version: 512
+class: "genp"
+attributes:
+    0x00000007 <blob>="my-app"
+    "acct"<blob>="anon"
+    "cdat"<timedate>=0x32303234303130313030303030305A00  "20240101000000Z\000"
+    "gena"<blob>=<NULL>
+    "svce"<blob>="my-app"
+keychain: "/Users/anon/Library/Keychains/login.keychain-db"
+version: 512
+class: "inet"
+attributes:
+    "acct"<blob>=0x616E6F6E0A  "anon\012"
+    "port"<uint32>=0x000020FB 
+    "ptcl"<uint32>="htps"
+    "srvr"<blob>="example.com"
+`)
+
+	items := parseDumpKeychain(out)
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	if items[0].class != "genp" || items[0].attributes["svce"] != "my-app" || items[0].attributes["acct"] != "anon" {
+		t.Errorf("Unexpected generic password %+v", items[0])
+	}
+
+	if _, ok := items[0].attributes["gena"]; ok {
+		t.Errorf("Expected NULL attributes to be skipped")
+	}
+
+	inet := items[1]
+	if inet.class != "inet" || inet.attributes["acct"] != "anon\n" || inet.attributes["srvr"] != "example.com" {
+		t.Errorf("Unexpected internet password %+v", inet)
+	}
+
+	if inet.attributes["port"] != "0x000020FB" || inet.attributes["ptcl"] != "htps" {
+		t.Errorf("Unexpected internet password port or protocol %+v", inet)
+	}
+}
@@ -0,0 +1,156 @@
+package keyring
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProviderInfo describes one layer of a provider chain.
+type ProviderInfo struct {
+	// Name identifies the kind of provider, e.g. "secret-service".
+	Name string
+	// Config holds the settings relevant to the layer. Secrets such as
+	// passphrases or salts are redacted.
+	Config map[string]string
+}
+
+// String formats the layer as name(key=value,...).
+func (p ProviderInfo) String() string {
+	if len(p.Config) == 0 {
+		return p.Name
+	}
+
+	keys := make([]string, 0, len(p.Config))
+	for k := range p.Config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	settings := make([]string, 0, len(keys))
+	for _, k := range keys {
+		settings = append(settings, k+"="+p.Config[k])
+	}
+	return p.Name + "(" + strings.Join(settings, ",") + ")"
+}
+
+// redacted replaces secret configuration values in ProviderInfo.
+const redacted = "<redacted>"
+
+// describer is implemented by providers which can describe themselves and the
+// providers they wrap.
+type describer interface {
+	Describe() []ProviderInfo
+}
+
+// Describe returns the chain of providers behind the package level functions,
+// outermost first.
+func Describe() []ProviderInfo {
+	return describe(Provider())
+}
+
+// describe returns the provider chain of k.
+func describe(k Keyring) []ProviderInfo {
+	if d, ok := k.(describer); ok {
+		return d.Describe()
+	}
+	return []ProviderInfo{{Name: fmt.Sprintf("%T", k)}}
+}
+
+// probeService is looked up by Available on providers which can't be probed
+// otherwise. No secret is expected to be stored under it.
+const probeService = "go-keyring-availability-probe"
+
+// prober is implemented by providers which can check that their backend can
+// be reached without looking up a secret, which may unlock the keyring and
+// prompt the user.
+type prober interface {
+	probe() error
+}
+
+// Available returns the name of the keyring backend in use and an error if
+// it can't be reached, so applications can report an unusable keyring up
+// front. Nothing is stored, and the Secret Service is only asked for its
+// collections, so a locked keyring isn't unlocked and the user isn't
+// prompted. Other providers look up a secret which doesn't exist.
+func Available() (string, error) {
+	k := Provider()
+	return backend(k), probe(k)
+}
+
+// probe checks that the backend of k can be reached.
+func probe(k Keyring) error {
+	if p, ok := k.(prober); ok {
+		return p.probe()
+	}
+	_, err := k.Exists(probeService, probeService)
+	return err
+}
+
+// Capability is a set of optional features of a provider, which fail with
+// ErrUnsupported where they're missing.
+type Capability uint
+
+const (
+	// CapabilityAttributes is the support of SetWithAttributes and the other
+	// attribute functions.
+	CapabilityAttributes Capability = 1 << iota
+	// CapabilityLabels is the support of SetWithLabel.
+	CapabilityLabels
+	// CapabilityModified is the support of GetModified.
+	CapabilityModified
+	// CapabilityCollections is the support of Collections and
+	// ActiveCollection.
+	CapabilityCollections
+	// CapabilityInventory is the support of enumerating all secrets, needed
+	// by Inventory, Walk, Purge and Export.
+	CapabilityInventory
+	// CapabilityLock is the support of Lock.
+	CapabilityLock
+)
+
+// Has reports whether c includes all of the capabilities of other.
+func (c Capability) Has(other Capability) bool {
+	return c&other == other
+}
+
+// capabilityReporter is implemented by wrapping providers whose methods don't
+// tell whether the wrapped provider supports them.
+type capabilityReporter interface {
+	capabilities() Capability
+}
+
+// Capabilities returns the optional features the provider behind the package
+// level functions supports, so callers can adapt to the platform instead of
+// trying each feature.
+func Capabilities() Capability {
+	return capabilities(Provider())
+}
+
+// capabilities returns the optional features of k.
+func capabilities(k Keyring) Capability {
+	if r, ok := k.(capabilityReporter); ok {
+		return r.capabilities()
+	}
+
+	var c Capability
+	if _, ok := k.(attributeKeyring); ok {
+		c |= CapabilityAttributes
+	}
+	if _, ok := k.(labelKeyring); ok {
+		c |= CapabilityLabels
+	}
+	if _, ok := k.(modifiedKeyring); ok {
+		c |= CapabilityModified
+	}
+	if _, ok := k.(collectionKeyring); ok {
+		c |= CapabilityCollections
+	}
+	if _, ok := k.(inventoryKeyring); ok {
+		c |= CapabilityInventory
+	}
+	if _, ok := k.(locker); ok {
+		c |= CapabilityLock
+	}
+	return c
+}
@@ -0,0 +1,67 @@
+package keyring
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestDescribe tests describing a stack of providers.
+func TestDescribe(t *testing.T) {
+	fp := &fileProvider{path: "/tmp/keyring.json"}
+	k := NewObscuredNamesProvider(NewObscuredNamesProvider(fp, []byte("inner")), []byte("outer"))
+
+	chain := describe(k)
+	if len(chain) != 3 {
+		t.Fatalf("Expected 3 layers, got %v", chain)
+	}
+
+	layers := make([]string, 0, len(chain))
+	for _, info := range chain {
+		layers = append(layers, info.String())
+	}
+
+	expected := "obscured-names(salt=<redacted>) -> obscured-names(salt=<redacted>) -> file(path=/tmp/keyring.json)"
+	if got := strings.Join(layers, " -> "); got != expected {
+		t.Errorf("Expected chain %s, got %s", expected, got)
+	}
+}
+
+// TestAvailable tests reporting the backend and whether it can be reached.
+func TestAvailable(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+
+	provider = NewObscuredNamesProvider(&mockProvider{}, []byte("salt"))
+	name, err := Available()
+	if name != "mock" || err != nil {
+		t.Errorf("Expected available mock, got %s, %v", name, err)
+	}
+
+	injected := errors.New("no keyring")
+	MockInitWithError(injected)
+	name, err = Available()
+	if name != "mock" || err != injected {
+		t.Errorf("Expected unavailable mock, got %s, %v", name, err)
+	}
+}
+
+// TestCapabilities tests reporting the optional features of providers.
+func TestCapabilities(t *testing.T) {
+	mp := &mockProvider{}
+	c := capabilities(mp)
+	if !c.Has(CapabilityAttributes|CapabilityLabels|CapabilityModified|CapabilityInventory) || c.Has(CapabilityLock) {
+		t.Errorf("Expected the mock's capabilities, got %b", c)
+	}
+
+	if c := capabilities(NewEnvProvider()); c != 0 {
+		t.Errorf("Expected no capabilities of the environment provider, got %b", c)
+	}
+
+	if c := capabilities(NewReadOnlyProvider(mp)); c != CapabilityInventory {
+		t.Errorf("Expected the read-only provider to pass the inventory through only, got %b", c)
+	}
+	if c := capabilities(NewReadOnlyProvider(NewEnvProvider())); c != 0 {
+		t.Errorf("Expected no capabilities of the read-only environment provider, got %b", c)
+	}
+}
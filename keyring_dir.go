@@ -0,0 +1,314 @@
+package keyring
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dirProvider stores every secret unencrypted in a file of its own,
+// readable by the owner only, at dir/service/user.
+type dirProvider struct {
+	dir string
+}
+
+// NewDirProvider returns a Keyring storing each secret in a file of its own
+// at dir/service/user, with service and user escaped like URL path segments.
+// Files are only readable and writable by the owner, and directories only
+// accessible by the owner, but the secrets aren't encrypted: they're
+// protected by file permissions alone, from other users but not from root or
+// anything running as the same user. Use NewFileProvider to encrypt them.
+//
+// It's meant for systems without a keyring such as WSL, where it's selected
+// on first use if there's no session bus, keeping the secrets below
+// $XDG_RUNTIME_DIR, which is usually a tmpfs cleared on logout. It's also
+// selected if $GO_KEYRING_PROVIDER is set to "dir".
+func NewDirProvider(dir string) Keyring {
+	return dirProvider{dir: dir}
+}
+
+// runtimeDir returns the directory of the provider selected by default, or ""
+// if there's no runtime directory.
+func runtimeDir() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "go-keyring")
+}
+
+// Describe returns the provider with its directory.
+func (d dirProvider) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "dir", Config: map[string]string{"dir": d.dir}}}
+}
+
+// Persistent reports whether the directory survives a reboot, which it's
+// assumed to do unless it's below $XDG_RUNTIME_DIR.
+func (d dirProvider) Persistent() bool {
+	runtime := os.Getenv("XDG_RUNTIME_DIR")
+	return runtime == "" || !strings.HasPrefix(d.dir, runtime)
+}
+
+// escapeName returns name escaped for use as a file name. Colons are escaped
+// as well, as Windows doesn't allow them in file names, and a leading dot, so
+// names can't refer to the directory itself or its parent or clash with
+// temporary files.
+func escapeName(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("invalid dir provider name %q", name)
+	}
+	escaped := strings.ReplaceAll(url.PathEscape(name), ":", "%3A")
+	if strings.HasPrefix(escaped, ".") {
+		escaped = "%2E" + escaped[1:]
+	}
+	return escaped, nil
+}
+
+// serviceDir returns the directory of the secrets of service.
+func (d dirProvider) serviceDir(service string) (string, error) {
+	name, err := escapeName(service)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d.dir, name), nil
+}
+
+// path returns the file of the secret of service and user.
+func (d dirProvider) path(service, user string) (string, error) {
+	dir, err := d.serviceDir(service)
+	if err != nil {
+		return "", err
+	}
+	name, err := escapeName(user)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Set stores user and pass in the keyring under the defined service name.
+func (d dirProvider) Set(service, user, pass string) error {
+	data := []byte(pass)
+	defer wipe(data)
+
+	return d.SetBytes(service, user, data)
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name. The file is replaced atomically, so readers never see a
+// partially written secret.
+func (d dirProvider) SetBytes(service, user string, data []byte) error {
+	path, err := d.path(service, user)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp creates the file readable by the owner only
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (d dirProvider) GetBytes(service, user string) ([]byte, error) {
+	path, err := d.path(service, user)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Get gets a secret from the keyring given a service name and a user.
+func (d dirProvider) Get(service, user string) (string, error) {
+	data, err := d.GetBytes(service, user)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(data)
+
+	return string(data), nil
+}
+
+// Exists reports whether a secret is stored for service and user.
+func (d dirProvider) Exists(service, user string) (bool, error) {
+	path, err := d.path(service, user)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetModified returns when the secret of service and user was last stored.
+func (d dirProvider) GetModified(service, user string) (time.Time, error) {
+	path, err := d.path(service, user)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring.
+func (d dirProvider) Delete(service, user string) error {
+	path, err := d.path(service, user)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// DeleteAll deletes all secrets for a given service by removing its
+// directory.
+func (d dirProvider) DeleteAll(service string) error {
+	_, err := d.deleteAllCount(service)
+	return err
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted.
+func (d dirProvider) deleteAllCount(service string) (int, error) {
+	// if service is empty, do nothing otherwise it might accidentally delete all secrets
+	if service == "" {
+		return 0, ErrNotFound
+	}
+
+	users, err := d.List(service)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	dir, err := d.serviceDir(service)
+	if err != nil {
+		return 0, err
+	}
+	return len(users), os.RemoveAll(dir)
+}
+
+// List returns the users with a secret stored for a given service.
+func (d dirProvider) List(service string) ([]string, error) {
+	dir, err := d.serviceDir(service)
+	if err != nil {
+		return []string{}, err
+	}
+
+	users, err := d.users(dir)
+	if err != nil {
+		return []string{}, err
+	}
+	if len(users) == 0 {
+		return users, ErrNotFound
+	}
+	return users, nil
+}
+
+// users returns the users with a file in dir.
+func (d dirProvider) users(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	users := []string{}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".tmp-") {
+			continue
+		}
+		user, err := url.PathUnescape(e.Name())
+		if err != nil {
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// inventory returns the service, user, size and modification time of all
+// secrets.
+func (d dirProvider) inventory() ([]InventoryItem, error) {
+	services, err := os.ReadDir(d.dir)
+	if os.IsNotExist(err) {
+		return []InventoryItem{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := []InventoryItem{}
+	for _, s := range services {
+		if !s.IsDir() {
+			continue
+		}
+		service, err := url.PathUnescape(s.Name())
+		if err != nil {
+			continue
+		}
+
+		users, err := d.users(filepath.Join(d.dir, s.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			path, err := d.path(service, user)
+			if err != nil {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			size := int(info.Size())
+			modified := info.ModTime()
+			items = append(items, InventoryItem{Service: service, User: user, Size: &size, Modified: &modified})
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,82 @@
+package keyring
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestDirProvider tests storing secrets as files of a directory.
+func TestDirProvider(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keyring")
+	dp := NewDirProvider(dir)
+
+	_, err := dp.Get(service, user)
+	assertError(t, err, ErrNotFound)
+
+	err = dp.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	pw, err := dp.Get(service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dir, service, user))
+		if err != nil || info.Mode().Perm() != 0o600 {
+			t.Errorf("Expected the file to be readable by the owner only, got %v, %v", info.Mode(), err)
+		}
+	}
+
+	// names can't escape the directory
+	for _, u := range []string{"../" + user, "..", ".tmp-" + user} {
+		err = dp.Set(service, u, password)
+		if err != nil {
+			t.Errorf("Should not fail, got: %s", err)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Dir(dir))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the keyring directory, got %d entries", len(entries))
+	}
+
+	users, err := dp.List(service)
+	sort.Strings(users)
+	if err != nil || strings.Join(users, ",") != "..,../"+user+",.tmp-"+user+","+user {
+		t.Errorf("Expected all users, got %v, %v", users, err)
+	}
+
+	n, err := deleteAllCount(dp, service)
+	if err != nil || n != 4 {
+		t.Errorf("Expected 4 secrets deleted, got %d, %v", n, err)
+	}
+
+	_, err = dp.List(service)
+	assertError(t, err, ErrNotFound)
+}
+
+// TestDirProviderSelected tests selecting the directory provider through
+// $GO_KEYRING_PROVIDER.
+func TestDirProviderSelected(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	t.Setenv(providerEnv, "dir")
+	provider = nil
+
+	dp, ok := Provider().(dirProvider)
+	if !ok || dp.dir != filepath.Join(runtimeDir, "go-keyring") {
+		t.Errorf("Expected the directory provider, got %#v", Provider())
+	}
+	if dp.Persistent() {
+		t.Errorf("Expected the runtime directory not to be persistent")
+	}
+}
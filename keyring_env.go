@@ -0,0 +1,194 @@
+package keyring
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	// providerEnv selects the provider on first use, see selectBackend.
+	providerEnv = "GO_KEYRING_PROVIDER"
+
+	// envSecretPrefix starts the names of the variables read by the
+	// environment provider.
+	envSecretPrefix = "GOKEYRING_"
+)
+
+// envVarProvider reads secrets from environment variables.
+type envVarProvider struct{}
+
+// NewEnvProvider returns a read-only Keyring reading the secret of service
+// and user from the environment variable GOKEYRING_<SERVICE>_<USER>, e.g.
+// in CI pipelines without a keyring. Service and user are uppercased and
+// every character other than a letter or digit is replaced by an
+// underscore, so "my-app" and "alice@example.com" are read from
+// GOKEYRING_MY_APP_ALICE_EXAMPLE_COM. Different names may map to the same
+// variable.
+//
+// It's selected on first use if $GO_KEYRING_PROVIDER is set to "env".
+// Storing and deleting secrets fails with ErrUnsupported, as does List since
+// the names can't be recovered from the variables.
+func NewEnvProvider() Keyring {
+	return envVarProvider{}
+}
+
+// environment holds what the provider is selected by. The checks of the
+// session are only made when needed, since some of them query D-Bus.
+type environment struct {
+	// provider is the value of $GO_KEYRING_PROVIDER.
+	provider string
+	// runtimeDir is the directory of the directory provider, "" if there's
+	// no runtime directory.
+	runtimeDir string
+	// sandbox, kde, wsl and noSessionBus report whether the process runs in
+	// a Flatpak or Snap sandbox, a KDE session with KWallet but no Secret
+	// Service, WSL, or without a D-Bus session bus.
+	sandbox, kde, wsl, noSessionBus func() bool
+}
+
+// sessionChecks sets the checks of the session in env, replaced on init by
+// the platforms which tell sessions apart. Elsewhere none of them applies.
+var sessionChecks = func(env *environment) {}
+
+// currentEnvironment returns the environment of the process.
+func currentEnvironment() environment {
+	never := func() bool { return false }
+	env := environment{
+		provider:     os.Getenv(providerEnv),
+		runtimeDir:   runtimeDir(),
+		sandbox:      never,
+		kde:          never,
+		wsl:          never,
+		noSessionBus: never,
+	}
+	sessionChecks(&env)
+	return env
+}
+
+// selectProvider returns the provider used unless one was set.
+func selectProvider() Keyring {
+	env := currentEnvironment()
+	switch name := selectBackend(env); name {
+	case "":
+		return defaultProvider()
+	case "dir":
+		return NewDirProvider(env.runtimeDir)
+	default:
+		return backends[name]()
+	}
+}
+
+// selectBackend returns the name of the backend to use in env, or "" for
+// the platform's default. The first of these rules which applies wins:
+//
+//  1. $GO_KEYRING_PROVIDER names the backend: "env", "dir" if there's a
+//     runtime directory, or "pass", "portal" and "secret-service" where
+//     they're supported
+//  2. in a Flatpak or Snap sandbox, the secret portal
+//  3. in a KDE session with KWallet but no Secret Service, KWallet
+//  4. in WSL without a session bus, the directory provider if there's a
+//     runtime directory
+//  5. the platform's default, e.g. the Secret Service
+//
+// Sandboxed applications which stored secrets in the Secret Service before
+// the portal was selected can keep it with "secret-service".
+func selectBackend(env environment) string {
+	switch env.provider {
+	case "env", "pass", "portal", "secret-service":
+		if _, ok := backends[env.provider]; ok {
+			return env.provider
+		}
+	case "dir":
+		if env.runtimeDir != "" {
+			return "dir"
+		}
+	}
+
+	switch {
+	case env.sandbox():
+		// sandboxed applications can only reach secrets through the portal
+		if _, ok := backends["portal"]; ok {
+			return "portal"
+		}
+	case env.kde():
+		// KDE sessions without a Secret Service can still reach KWallet
+		// directly
+		return "kwallet"
+	case env.wsl() && env.noSessionBus() && env.runtimeDir != "":
+		// WSL usually has neither a session bus nor a keyring
+		return "dir"
+	}
+	return ""
+}
+
+// Describe returns the provider.
+func (e envVarProvider) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "env"}}
+}
+
+// Persistent reports that the environment is lost with the process.
+func (e envVarProvider) Persistent() bool {
+	return false
+}
+
+// variable returns the name of the environment variable of service and
+// user.
+func (e envVarProvider) variable(service, user string) string {
+	name := strings.ToUpper(envSecretPrefix + service + "_" + user)
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Set is not supported as the environment is read-only.
+func (e envVarProvider) Set(service, user, pass string) error {
+	return ErrUnsupported
+}
+
+// Get gets a secret from the environment given a service name and a user.
+func (e envVarProvider) Get(service, user string) (string, error) {
+	secret, ok := os.LookupEnv(e.variable(service, user))
+	if !ok {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// SetBytes is not supported as the environment is read-only.
+func (e envVarProvider) SetBytes(service, user string, data []byte) error {
+	return ErrUnsupported
+}
+
+// GetBytes gets binary data from the environment given a service name and a
+// user.
+func (e envVarProvider) GetBytes(service, user string) ([]byte, error) {
+	secret, err := e.Get(service, user)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(secret), nil
+}
+
+// Exists reports whether a secret is set for service and user.
+func (e envVarProvider) Exists(service, user string) (bool, error) {
+	_, ok := os.LookupEnv(e.variable(service, user))
+	return ok, nil
+}
+
+// Delete is not supported as the environment is read-only.
+func (e envVarProvider) Delete(service, user string) error {
+	return ErrUnsupported
+}
+
+// DeleteAll is not supported as the environment is read-only.
+func (e envVarProvider) DeleteAll(service string) error {
+	return ErrUnsupported
+}
+
+// List is not supported as users can't be recovered from variable names.
+func (e envVarProvider) List(service string) ([]string, error) {
+	return []string{}, ErrUnsupported
+}
@@ -0,0 +1,96 @@
+package keyring
+
+import "testing"
+
+// TestEnvProvider tests reading secrets from environment variables.
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("GOKEYRING_TEST_SERVICE_ALICE_EXAMPLE_COM", password)
+
+	ep := NewEnvProvider()
+
+	pw, err := ep.Get("test-service", "alice@example.com")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	ok, err := ep.Exists("test-service", "alice@example.com")
+	if err != nil || !ok {
+		t.Errorf("Expected the secret to exist, got %t, %v", ok, err)
+	}
+
+	_, err = ep.Get("test-service", "bob")
+	assertError(t, err, ErrNotFound)
+
+	err = ep.Set("test-service", "bob", password)
+	assertError(t, err, ErrUnsupported)
+
+	err = ep.Delete("test-service", "alice@example.com")
+	assertError(t, err, ErrUnsupported)
+}
+
+// TestEnvProviderSelected tests selecting the environment provider through
+// $GO_KEYRING_PROVIDER.
+func TestEnvProviderSelected(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+
+	t.Setenv(providerEnv, "env")
+	provider = nil
+
+	if _, ok := Provider().(envVarProvider); !ok {
+		t.Errorf("Expected the environment provider, got %T", Provider())
+	}
+}
+
+// TestSelectBackend tests the order in which the backend is selected.
+func TestSelectBackend(t *testing.T) {
+	yes := func() bool { return true }
+	no := func() bool { return false }
+
+	// pass, the portal and the Secret Service aren't available on every
+	// platform
+	pass, portal, secretService := "", "", ""
+	if _, ok := backends["pass"]; ok {
+		pass = "pass"
+	}
+	if _, ok := backends["portal"]; ok {
+		portal = "portal"
+	}
+	if _, ok := backends["secret-service"]; ok {
+		secretService = "secret-service"
+	}
+
+	for _, tc := range []struct {
+		name string
+		env  environment
+		want string
+	}{
+		{"default", environment{}, ""},
+		{"env", environment{provider: "env", kde: yes}, "env"},
+		{"pass", environment{provider: "pass"}, pass},
+		{"portal", environment{provider: "portal", kde: yes}, portal},
+		{"secret service in sandbox", environment{provider: "secret-service", sandbox: yes}, secretService},
+		{"dir", environment{provider: "dir", runtimeDir: "/run/user/1000/go-keyring", kde: yes}, "dir"},
+		{"dir without runtime dir", environment{provider: "dir"}, ""},
+		{"unknown", environment{provider: "unknown"}, ""},
+		{"sandbox before kde", environment{sandbox: yes, kde: yes}, portal},
+		{"kde before wsl", environment{kde: yes, wsl: yes, noSessionBus: yes, runtimeDir: "/run"}, "kwallet"},
+		{"wsl without bus", environment{wsl: yes, noSessionBus: yes, runtimeDir: "/run"}, "dir"},
+		{"wsl with bus", environment{wsl: yes, noSessionBus: no, runtimeDir: "/run"}, ""},
+		{"wsl without runtime dir", environment{wsl: yes, noSessionBus: yes}, ""},
+	} {
+		env := tc.env
+		for _, check := range []*func() bool{&env.sandbox, &env.kde, &env.wsl, &env.noSessionBus} {
+			if *check == nil {
+				*check = no
+			}
+		}
+
+		if got := selectBackend(env); got != tc.want {
+			t.Errorf("%s: expected backend %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
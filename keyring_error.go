@@ -0,0 +1,72 @@
+package keyring
+
+import (
+	"errors"
+	"fmt"
+)
+
+// KeyringError records the operation, service and user of a failed call
+// along with the error of the backend, e.g. a D-Bus or syscall error.
+type KeyringError struct {
+	Op      string
+	Service string
+	User    string
+	Err     error
+}
+
+func (e *KeyringError) Error() string {
+	if e.User == "" {
+		return fmt.Sprintf("keyring: %s %q: %v", e.Op, e.Service, e.Err)
+	}
+	return fmt.Sprintf("keyring: %s %q for user %q: %v", e.Op, e.Service, e.User, e.Err)
+}
+
+func (e *KeyringError) Unwrap() error {
+	return e.Err
+}
+
+// wrapError wraps err of the backend in a KeyringError. Errors of this
+// package are returned as is, so comparing them with == keeps working. The
+// errors held by a *BatchError or ServiceErrors are wrapped in place, so
+// callers can still type assert the batch error.
+func wrapError(op, service, user string, err error) error {
+	switch e := err.(type) {
+	case *KeyringError:
+		return e
+	case *BatchError:
+		e.Err = wrapError(op, service, e.User, e.Err)
+		return e
+	case ServiceErrors:
+		for s, serviceErr := range e {
+			e[s] = wrapError(op, s, user, serviceErr)
+		}
+		return e
+	}
+
+	if err == nil || packageError(err) {
+		return err
+	}
+	return &KeyringError{Op: op, Service: service, User: user, Err: err}
+}
+
+// packageError reports whether err is one of the errors of this package,
+// which describe the outcome of a call rather than a failure of the backend.
+func packageError(err error) bool {
+	for _, e := range []error{
+		ErrNotFound,
+		ErrSetDataTooBig,
+		ErrMultipleMatches,
+		ErrWeakSecret,
+		ErrAlreadyExists,
+		ErrUnsupported,
+		ErrLocked,
+		ErrPromptDismissed,
+		ErrSecretTooLong,
+		ErrUnsupportedPlatform,
+	} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,15 +1,24 @@
 package keyring
 
 import (
-	"errors"
+	"fmt"
 	"runtime"
 )
 
-// All of the following methods error out on unsupported platforms
-var ErrUnsupportedPlatform = errors.New("unsupported platform: " + runtime.GOOS)
+// All of the following methods error out on unsupported platforms. The error
+// wraps ErrUnsupported, so errors.Is reports it like other missing features.
+var ErrUnsupportedPlatform = fmt.Errorf("unsupported platform: %s: %w", runtime.GOOS, ErrUnsupported)
 
 type fallbackServiceProvider struct{}
 
+func (fallbackServiceProvider) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "unsupported"}}
+}
+
+func (fallbackServiceProvider) Persistent() bool {
+	return false
+}
+
 func (fallbackServiceProvider) Set(service, user, pass string) error {
 	return ErrUnsupportedPlatform
 }
@@ -18,10 +27,26 @@ func (fallbackServiceProvider) Get(service, user string) (string, error) {
 	return "", ErrUnsupportedPlatform
 }
 
+func (fallbackServiceProvider) SetBytes(service, user string, data []byte) error {
+	return ErrUnsupportedPlatform
+}
+
+func (fallbackServiceProvider) GetBytes(service, user string) ([]byte, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+func (fallbackServiceProvider) Exists(service, user string) (bool, error) {
+	return false, ErrUnsupportedPlatform
+}
+
 func (fallbackServiceProvider) Delete(service, user string) error {
 	return ErrUnsupportedPlatform
 }
 
+func (fallbackServiceProvider) List(service string) ([]string, error) {
+	return []string{}, ErrUnsupportedPlatform
+}
+
 func (fallbackServiceProvider) DeleteAll(service string) error {
 	return ErrUnsupportedPlatform
 }
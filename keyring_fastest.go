@@ -0,0 +1,115 @@
+package keyring
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// speedProbeService is the service of the secret stored and deleted again
+// by NewFastestProvider.
+const speedProbeService = "go-keyring-speed-probe"
+
+// NewFastestProvider returns the fastest of the available candidates, e.g.
+// for CLIs doing many keyring operations, to install with SetProvider.
+// Available then reports the chosen backend. Each candidate is benchmarked
+// with a Set, Get and Delete of a probe secret, and candidates failing any of
+// them are skipped. If none is available, the error of the last one is
+// returned.
+//
+// The choice is cached in the JSON file at cachePath, keyed by the
+// candidates, so later runs skip the benchmark; an empty cachePath benchmarks
+// every time. Note that the candidates don't share their secrets: secrets
+// stored with one aren't found once another one is faster.
+func NewFastestProvider(cachePath string, candidates ...Keyring) (Keyring, error) {
+	names := make([]string, len(candidates))
+	for i, k := range candidates {
+		names[i] = describeChain(k)
+	}
+	key := strings.Join(names, " ")
+
+	cache := map[string]string{}
+	if cachePath != "" {
+		data, err := os.ReadFile(cachePath)
+		if err == nil {
+			_ = json.Unmarshal(data, &cache)
+		}
+		for i, name := range names {
+			if cache[key] == name {
+				return candidates[i], nil
+			}
+		}
+	}
+
+	var fastest Keyring
+	var fastestName string
+	var best time.Duration
+	err := errors.New("no candidate providers")
+	for i, k := range candidates {
+		var elapsed time.Duration
+		elapsed, err = benchmark(k)
+		if err != nil {
+			continue
+		}
+		if fastest == nil || elapsed < best {
+			fastest, fastestName, best = k, names[i], elapsed
+		}
+	}
+	if fastest == nil {
+		return nil, err
+	}
+
+	if cachePath != "" {
+		cache[key] = fastestName
+		data, err := json.Marshal(cache)
+		if err != nil {
+			return nil, err
+		}
+		err = os.MkdirAll(filepath.Dir(cachePath), 0700)
+		if err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(cachePath, data, 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fastest, nil
+}
+
+// describeChain returns the provider chain of k as a single string.
+func describeChain(k Keyring) string {
+	infos := describe(k)
+	layers := make([]string, len(infos))
+	for i, info := range infos {
+		layers[i] = info.String()
+	}
+	return strings.Join(layers, "/")
+}
+
+// benchmark returns how long storing, reading and deleting the probe secret
+// with k takes.
+func benchmark(k Keyring) (time.Duration, error) {
+	start := time.Now()
+
+	err := k.Set(speedProbeService, speedProbeService, speedProbeService)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = k.Get(speedProbeService, speedProbeService)
+	if err != nil {
+		_ = k.Delete(speedProbeService, speedProbeService)
+		return 0, err
+	}
+
+	err = k.Delete(speedProbeService, speedProbeService)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
@@ -0,0 +1,59 @@
+package keyring
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// slowProvider is a mock provider taking delay for every Set.
+type slowProvider struct {
+	*mockProvider
+	name  string
+	delay time.Duration
+}
+
+func (s slowProvider) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: s.name}}
+}
+
+func (s slowProvider) Set(service, user, pass string) error {
+	time.Sleep(s.delay)
+	return s.mockProvider.Set(service, user, pass)
+}
+
+// TestNewFastestProvider tests choosing the fastest available provider and
+// caching the choice.
+func TestNewFastestProvider(t *testing.T) {
+	slow := slowProvider{&mockProvider{}, "slow", 20 * time.Millisecond}
+	fast := slowProvider{&mockProvider{}, "fast", 0}
+	broken := slowProvider{&mockProvider{mockError: errors.New("unavailable")}, "broken", 0}
+	cache := filepath.Join(t.TempDir(), "fastest.json")
+
+	k, err := NewFastestProvider(cache, broken, slow, fast)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if k != fast {
+		t.Errorf("Expected the fast provider, got %v", describe(k))
+	}
+
+	_, err = fast.Get(speedProbeService, speedProbeService)
+	assertError(t, err, ErrNotFound)
+
+	// the cached choice is kept even though fast became slow
+	fast.delay = 40 * time.Millisecond
+	k, err = NewFastestProvider(cache, broken, slow, fast)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if describe(k)[0].Name != "fast" {
+		t.Errorf("Expected the cached choice, got %v", describe(k))
+	}
+
+	_, err = NewFastestProvider("", broken)
+	if err == nil {
+		t.Errorf("Expected an error without available providers")
+	}
+}
@@ -0,0 +1,570 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// fileProvider stores secrets in a single JSON file, each secret encrypted
+// with AES-GCM.
+type fileProvider struct {
+	path string
+	// key returns the 32 byte AES key used to encrypt the secrets.
+	key func() ([]byte, error)
+	mu  sync.Mutex
+}
+
+// NewFileProvider returns a Keyring storing secrets in the file at path,
+// encrypted with a key derived from passphrase using scrypt. It's meant for
+// systems without a keyring service, e.g. headless servers. The scrypt salt
+// is kept next to the file, in path with a ".salt" suffix, together with a
+// check of the key, so a wrong passphrase fails every call up front instead
+// of storing secrets under a second key. Processes sharing the file take
+// turns changing it through a lock file, path with a ".lock" suffix.
+func NewFileProvider(path string, passphrase []byte) Keyring {
+	f := &fileProvider{path: path}
+	secret := &passphraseKey{saltPath: path + ".salt", passphrase: passphrase, verify: f.verifyKey}
+	f.key = secret.Key
+	return f
+}
+
+const (
+	// saltSize is the length of the scrypt salt.
+	saltSize = 16
+	// keyCheckSize is the length of the key check following the salt.
+	keyCheckSize = sha256.Size
+)
+
+// errWrongPassphrase is returned by the file provider if the passphrase
+// doesn't derive the key the file is encrypted with.
+var errWrongPassphrase = errors.New("wrong passphrase for keyring file")
+
+// passphraseKey derives the file encryption key from a passphrase.
+type passphraseKey struct {
+	saltPath   string
+	passphrase []byte
+	// verify checks the key against the secrets already stored, for salt
+	// files written without a key check.
+	verify func(key []byte) error
+	mu     sync.Mutex
+	key    []byte
+}
+
+// Key returns the file encryption key, deriving it on first use. A random
+// salt is created if there is none yet. errWrongPassphrase is returned if
+// the key doesn't match the key check stored with the salt.
+func (p *passphraseKey) Key() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.key != nil {
+		return p.key, nil
+	}
+
+	key, err := p.read()
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = p.create()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.key = key
+	return key, nil
+}
+
+// derive derives the key from the passphrase and salt.
+func (p *passphraseKey) derive(salt []byte) ([]byte, error) {
+	// recommended interactive parameters, taking about 100ms
+	return scrypt.Key(p.passphrase, salt, 1<<15, 8, 1, 32)
+}
+
+// keyCheck returns the value stored to check key, which doesn't reveal it.
+func keyCheck(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("go-keyring key check"))
+	return mac.Sum(nil)
+}
+
+// read derives the key from the existing salt file and checks it. A salt
+// file without a key check gets one once the key is verified against the
+// stored secrets.
+func (p *passphraseKey) read() ([]byte, error) {
+	data, err := os.ReadFile(p.saltPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != saltSize && len(data) != saltSize+keyCheckSize {
+		return nil, errors.New("malformed keyring salt file")
+	}
+
+	key, err := p.derive(data[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == saltSize+keyCheckSize {
+		if !hmac.Equal(data[saltSize:], keyCheck(key)) {
+			return nil, errWrongPassphrase
+		}
+		return key, nil
+	}
+
+	if p.verify != nil {
+		err = p.verify(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, p.write(append(data, keyCheck(key)...), true)
+}
+
+// create creates a random salt with the check of the key derived from it,
+// and returns the key. If another process created a salt concurrently, the
+// key is derived from that one instead.
+func (p *passphraseKey) create() ([]byte, error) {
+	salt := make([]byte, saltSize)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := p.derive(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.write(append(salt, keyCheck(key)...), false)
+	if errors.Is(err, os.ErrExist) {
+		return p.read()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// write writes data to the salt file. An existing file is only replaced if
+// replace is set, otherwise os.ErrExist is returned.
+func (p *passphraseKey) write(data []byte, replace bool) error {
+	err := os.MkdirAll(filepath.Dir(p.saltPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.saltPath), filepath.Base(p.saltPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if replace {
+		return os.Rename(tmp.Name(), p.saltPath)
+	}
+	// unlike a rename, linking doesn't replace a salt created concurrently
+	// by another process
+	return os.Link(tmp.Name(), p.saltPath)
+}
+
+// fileStore maps service and user to the encrypted secret.
+type fileStore map[string]map[string][]byte
+
+// Describe returns the provider and the path of its file.
+func (f *fileProvider) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "file", Config: map[string]string{"path": f.path}}}
+}
+
+// Persistent reports that the keyring file survives a reboot.
+func (f *fileProvider) Persistent() bool {
+	return true
+}
+
+// load reads the store from disk. A missing file is an empty store.
+func (f *fileProvider) load() (fileStore, error) {
+	store := fileStore{}
+
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &store)
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// save atomically replaces the store on disk.
+func (f *fileProvider) save(store fileStore) error {
+	data, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(f.path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// aead returns the cipher used to seal and open secrets.
+func (f *fileProvider) aead() (cipher.AEAD, error) {
+	key, err := f.key()
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(key)
+}
+
+// newAEAD returns the cipher sealing and opening secrets with key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// open opens a sealed secret of service and user.
+func open(aead cipher.AEAD, service, user string, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("malformed secret in keyring file")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData(service, user))
+}
+
+// verifyKey checks that key opens a secret of the file, if there's any, and
+// returns errWrongPassphrase otherwise.
+func (f *fileProvider) verifyKey(key []byte) error {
+	store, err := f.load()
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	for service, users := range store {
+		for user, sealed := range users {
+			data, err := open(aead, service, user, sealed)
+			if err != nil {
+				return errWrongPassphrase
+			}
+			wipe(data)
+			return nil
+		}
+	}
+	return nil
+}
+
+// lock serializes changes of the file, within the process and with other
+// processes, and returns the function unlocking it.
+func (f *fileProvider) lock() (func(), error) {
+	f.mu.Lock()
+	unlock, err := lockFile(f.path + ".lock")
+	if err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlock()
+		f.mu.Unlock()
+	}, nil
+}
+
+// additionalData binds an encrypted secret to its service and user so it
+// can't be moved to another entry.
+func additionalData(service, user string) []byte {
+	return []byte(service + "\x00" + user)
+}
+
+// inventory returns the service, user and size of all secrets, computing the
+// size from the ciphertext without decrypting it.
+func (f *fileProvider) inventory() ([]InventoryItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	store, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+
+	// the sealed secret is prefixed by the nonce and suffixed by the tag
+	const overhead = 12 + 16
+
+	items := []InventoryItem{}
+	for service, users := range store {
+		for user, sealed := range users {
+			size := len(sealed) - overhead
+			items = append(items, InventoryItem{Service: service, User: user, Size: &size})
+		}
+	}
+	return items, nil
+}
+
+// Set stores user and pass in the keyring under the defined service
+// name.
+func (f *fileProvider) Set(service, user, pass string) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	store, err := f.load()
+	if err != nil {
+		return err
+	}
+
+	data := []byte(pass)
+	defer wipe(data)
+
+	return f.set(store, service, user, data)
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (f *fileProvider) SetBytes(service, user string, data []byte) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	store, err := f.load()
+	if err != nil {
+		return err
+	}
+
+	return f.set(store, service, user, data)
+}
+
+// SetIfAbsent stores user and pass in the keyring under the defined service
+// name unless a secret is already stored for them.
+func (f *fileProvider) SetIfAbsent(service, user, pass string) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	store, err := f.load()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := store[service][user]; ok {
+		return ErrAlreadyExists
+	}
+
+	data := []byte(pass)
+	defer wipe(data)
+
+	return f.set(store, service, user, data)
+}
+
+// set seals data into store and saves it. Callers must hold the lock.
+func (f *fileProvider) set(store fileStore, service, user string, data []byte) error {
+	aead, err := f.aead()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+
+	if store[service] == nil {
+		store[service] = make(map[string][]byte)
+	}
+	store[service][user] = aead.Seal(nonce, nonce, data, additionalData(service, user))
+
+	return f.save(store)
+}
+
+// Get gets a secret from the keyring given a service name and a user.
+func (f *fileProvider) Get(service, user string) (string, error) {
+	secret, err := f.GetBytes(service, user)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(secret)
+
+	return string(secret), nil
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (f *fileProvider) GetBytes(service, user string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	store, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, ok := store[service][user]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	aead, err := f.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, service, user, sealed)
+}
+
+// Exists reports whether a secret is stored for service and user without
+// decrypting it.
+func (f *fileProvider) Exists(service, user string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	store, err := f.load()
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := store[service][user]
+	return ok, nil
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring.
+func (f *fileProvider) Delete(service, user string) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	store, err := f.load()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := store[service][user]; !ok {
+		return ErrNotFound
+	}
+
+	delete(store[service], user)
+	if len(store[service]) == 0 {
+		delete(store, service)
+	}
+
+	return f.save(store)
+}
+
+// List returns the users with a secret stored for a given service.
+func (f *fileProvider) List(service string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	store, err := f.load()
+	if err != nil {
+		return []string{}, err
+	}
+
+	users := make([]string, 0, len(store[service]))
+	for user := range store[service] {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	if len(users) == 0 {
+		return users, ErrNotFound
+	}
+	return users, nil
+}
+
+// DeleteAll deletes all secrets for a given service
+func (f *fileProvider) DeleteAll(service string) error {
+	_, err := f.deleteAllCount(service)
+	return err
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted.
+func (f *fileProvider) deleteAllCount(service string) (int, error) {
+	// if service is empty, do nothing otherwise it might accidentally delete all secrets
+	if service == "" {
+		return 0, ErrNotFound
+	}
+
+	unlock, err := f.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	store, err := f.load()
+	if err != nil {
+		return 0, err
+	}
+
+	n := len(store[service])
+	if n == 0 {
+		return 0, nil
+	}
+
+	delete(store, service)
+	return n, f.save(store)
+}
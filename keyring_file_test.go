@@ -0,0 +1,102 @@
+package keyring
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestFileProviderPassphrase tests that secrets can only be read back with
+// the passphrase they were stored with.
+func TestFileProviderPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+
+	err := NewFileProvider(path, []byte("passphrase")).Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	pw, err := NewFileProvider(path, []byte("passphrase")).Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	_, err = NewFileProvider(path, []byte("wrong")).Get(service, user)
+	if err == nil {
+		t.Errorf("Expected an error for the wrong passphrase")
+	}
+}
+
+// TestFileProviderWrongPassphrase tests that a wrong passphrase fails reads
+// and writes alike, so secrets aren't stored under a second key.
+func TestFileProviderWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+
+	err := NewFileProvider(path, []byte("passphrase")).Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	wrong := NewFileProvider(path, []byte("wrong"))
+	_, err = wrong.Get(service, user)
+	assertError(t, err, errWrongPassphrase)
+	err = wrong.Set(service, user+"2", password)
+	assertError(t, err, errWrongPassphrase)
+
+	// salt files without a key check are verified against the secrets
+	salt, err := os.ReadFile(path + ".salt")
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	err = os.WriteFile(path+".salt", salt[:saltSize], 0600)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	_, err = NewFileProvider(path, []byte("wrong")).Get(service, user)
+	assertError(t, err, errWrongPassphrase)
+
+	pw, err := NewFileProvider(path, []byte("passphrase")).Get(service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+	upgraded, _ := os.ReadFile(path + ".salt")
+	if !bytes.Equal(upgraded, salt) {
+		t.Errorf("Expected the key check to be added to the salt file")
+	}
+}
+
+// TestFileProviderProcesses tests that providers not sharing a mutex, like
+// separate processes, don't lose each other's changes.
+func TestFileProviderProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	key := make([]byte, 32)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f := &fileProvider{path: path, key: func() ([]byte, error) { return key, nil }}
+			for j := 0; j < 10; j++ {
+				err := f.Set(service, fmt.Sprintf("%s%d-%d", user, i, j), password)
+				if err != nil {
+					t.Errorf("Should not fail, got: %s", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	f := &fileProvider{path: path, key: func() ([]byte, error) { return key, nil }}
+	users, err := f.List(service)
+	if err != nil || len(users) != 200 {
+		t.Errorf("Expected 200 users, got %d, %v", len(users), err)
+	}
+}
@@ -0,0 +1,460 @@
+package keyring
+
+import (
+	"strings"
+	"time"
+)
+
+// instance is the Keyring returned by New. It prepends a prefix to every
+// service of the underlying keyring and applies the validator, the maximum
+// secret length, the logger, the metrics hook and the refreshers to its
+// calls. The package level functions use the instance returned by std.
+type instance struct {
+	keyring Keyring
+	prefix  string
+}
+
+// std returns the instance behind the package level functions, which uses
+// the active provider and the namespace set with SetNamespace. An instance
+// installed with SetProvider is used with the namespace added to its prefix,
+// so its calls aren't validated and reported twice.
+func std() instance {
+	k := Provider()
+	providerMu.RLock()
+	prefix := namespace
+	providerMu.RUnlock()
+
+	if in, ok := k.(instance); ok {
+		return instance{keyring: in.keyring, prefix: in.prefix + prefix}
+	}
+	return instance{keyring: k, prefix: prefix}
+}
+
+// service returns service with the prefix. An empty service stays empty, so
+// it's still rejected where it would match every secret.
+func (i instance) service(service string) string {
+	if service == "" {
+		return ""
+	}
+	return i.prefix + service
+}
+
+// finish wraps err of a call started at start like wrapError and reports the
+// call to the logger and the metrics hook.
+func (i instance) finish(op, service, user string, start time.Time, err error) error {
+	err = wrapError(op, service, user, err)
+	providerMu.RLock()
+	log, observe := logger, metrics
+	providerMu.RUnlock()
+	if log == nil && observe == nil {
+		return err
+	}
+
+	dur := time.Since(start)
+	if log != nil {
+		log(op, service, user, dur, err)
+	}
+	if observe != nil {
+		observe(op, backend(i.keyring), outcome(err), dur)
+	}
+	return err
+}
+
+// Describe returns the provider chain with the prefix, if any.
+func (i instance) Describe() []ProviderInfo {
+	if i.prefix == "" {
+		return describe(i.keyring)
+	}
+	info := ProviderInfo{Name: "namespace", Config: map[string]string{"prefix": i.prefix}}
+	return append([]ProviderInfo{info}, describe(i.keyring)...)
+}
+
+// Persistent reports whether the underlying keyring survives a reboot.
+func (i instance) Persistent() bool {
+	return persistent(i.keyring)
+}
+
+// capabilities returns the optional features of the underlying keyring.
+func (i instance) capabilities() Capability {
+	return capabilities(i.keyring)
+}
+
+// probe checks that the backend of the underlying keyring can be reached.
+func (i instance) probe() error {
+	return probe(i.keyring)
+}
+
+// closeSession closes the session of the underlying keyring, if it keeps
+// one open.
+func (i instance) closeSession() error {
+	if c, ok := i.keyring.(sessionCloser); ok {
+		return c.closeSession()
+	}
+	return nil
+}
+
+// flush forgets the secrets remembered by the underlying keyring, if any.
+func (i instance) flush() {
+	if c, ok := i.keyring.(cacheFlusher); ok {
+		c.flush()
+	}
+}
+
+// Set stores user and pass in the keyring under the defined service name.
+func (i instance) Set(service, user, pass string) error {
+	if err := validate(service, user, pass); err != nil {
+		return err
+	}
+	start := begin()
+	return i.finish("set", service, user, start, i.keyring.Set(i.service(service), user, pass))
+}
+
+// SetIfAbsent stores pass unless a secret is already stored for service and
+// user.
+func (i instance) SetIfAbsent(service, user, pass string) error {
+	if err := validate(service, user, pass); err != nil {
+		return err
+	}
+	start := begin()
+	return i.finish("set if absent", service, user, start, setIfAbsent(i.keyring, i.service(service), user, pass))
+}
+
+// SetWithLabel stores pass shown under label.
+func (i instance) SetWithLabel(service, user, pass, label string) error {
+	p, ok := i.keyring.(labelKeyring)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := validate(service, user, pass); err != nil {
+		return err
+	}
+	start := begin()
+	return i.finish("set with label", service, user, start, p.SetWithLabel(i.service(service), user, pass, label))
+}
+
+// Get gets a secret from the keyring given a service name and a user.
+func (i instance) Get(service, user string) (string, error) {
+	start := begin()
+	secret, err := i.keyring.Get(i.service(service), user)
+	if err = i.finish("get", service, user, start, err); err != nil {
+		return "", err
+	}
+	return i.refresh(service, user, secret)
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (i instance) SetBytes(service, user string, data []byte) error {
+	if err := validate(service, user, string(data)); err != nil {
+		return err
+	}
+	start := begin()
+	return i.finish("set bytes", service, user, start, i.keyring.SetBytes(i.service(service), user, data))
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (i instance) GetBytes(service, user string) ([]byte, error) {
+	start := begin()
+	data, err := i.keyring.GetBytes(i.service(service), user)
+	if err = i.finish("get bytes", service, user, start, err); err != nil {
+		return nil, err
+	}
+	secret, err := i.refresh(service, user, string(data))
+	wipe(data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(secret), nil
+}
+
+// Exists reports whether a secret is stored for service and user.
+func (i instance) Exists(service, user string) (bool, error) {
+	start := begin()
+	ok, err := i.keyring.Exists(i.service(service), user)
+	return ok, i.finish("exists", service, user, start, err)
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring.
+func (i instance) Delete(service, user string) error {
+	start := begin()
+	return i.finish("delete", service, user, start, i.keyring.Delete(i.service(service), user))
+}
+
+// DeleteAll deletes all secrets for a given service
+func (i instance) DeleteAll(service string) error {
+	start := begin()
+	return i.finish("delete all", service, "", start, i.keyring.DeleteAll(i.service(service)))
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted, if the underlying keyring can count them.
+func (i instance) deleteAllCount(service string) (int, error) {
+	start := begin()
+	if service == "" {
+		return 0, i.finish("delete all", service, "", start, ErrNotFound)
+	}
+	n, err := deleteAllCount(i.keyring, i.service(service))
+	return n, i.finish("delete all", service, "", start, err)
+}
+
+// List returns the users with a secret stored for a given service.
+func (i instance) List(service string) ([]string, error) {
+	start := begin()
+	users, err := i.keyring.List(i.service(service))
+	return users, i.finish("list", service, "", start, err)
+}
+
+// Rename moves the secret of oldUser to newUser within service.
+func (i instance) Rename(service, oldUser, newUser string) error {
+	start := begin()
+	if p, ok := i.keyring.(renamer); ok {
+		return i.finish("rename", service, oldUser, start, p.Rename(i.service(service), oldUser, newUser))
+	}
+	return i.finish("rename", service, oldUser, start, rename(i.keyring, i.service(service), oldUser, newUser))
+}
+
+// Copy stores the secret of srcUser in srcService for dstUser in dstService.
+func (i instance) Copy(srcService, srcUser, dstService, dstUser string, overwrite bool) error {
+	start := begin()
+	if p, ok := i.keyring.(copier); ok {
+		return i.finish("copy", srcService, srcUser, start, p.Copy(i.service(srcService), srcUser, i.service(dstService), dstUser, overwrite))
+	}
+	return i.finish("copy", srcService, srcUser, start, copySecret(i.keyring, i.service(srcService), srcUser, i.service(dstService), dstUser, overwrite))
+}
+
+// SetWithAttributes stores pass under service, tagged with attrs.
+func (i instance) SetWithAttributes(service string, attrs map[string]string, pass string) error {
+	p, ok := i.keyring.(attributeKeyring)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := validate(service, attrs["username"], pass); err != nil {
+		return err
+	}
+	start := begin()
+	return i.finish("set with attributes", service, attrs["username"], start, p.SetWithAttributes(i.service(service), attrs, pass))
+}
+
+// GetWithAttributes gets the secret of service matching attrs.
+func (i instance) GetWithAttributes(service string, attrs map[string]string) (string, error) {
+	p, ok := i.keyring.(attributeKeyring)
+	if !ok {
+		return "", ErrUnsupported
+	}
+	start := begin()
+	secret, err := p.GetWithAttributes(i.service(service), attrs)
+	return secret, i.finish("get with attributes", service, attrs["username"], start, err)
+}
+
+// ExistsWithAttributes reports whether a secret of service matches attrs.
+func (i instance) ExistsWithAttributes(service string, attrs map[string]string) (bool, error) {
+	p, ok := i.keyring.(attributeKeyring)
+	if !ok {
+		return false, ErrUnsupported
+	}
+	start := begin()
+	ok, err := p.ExistsWithAttributes(i.service(service), attrs)
+	return ok, i.finish("exists with attributes", service, attrs["username"], start, err)
+}
+
+// DeleteWithAttributes deletes the secret of service matching attrs.
+func (i instance) DeleteWithAttributes(service string, attrs map[string]string) error {
+	p, ok := i.keyring.(attributeKeyring)
+	if !ok {
+		return ErrUnsupported
+	}
+	// without any attribute the only secret in the keyring would match
+	if service == "" && len(attrs) == 0 {
+		return ErrNotFound
+	}
+	start := begin()
+	return i.finish("delete with attributes", service, attrs["username"], start, p.DeleteWithAttributes(i.service(service), attrs))
+}
+
+// Find returns the attributes of all secrets matching attrs.
+func (i instance) Find(attrs map[string]string) ([]map[string]string, error) {
+	p, ok := i.keyring.(attributeKeyring)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	start := begin()
+	found, err := p.Find(attrs)
+	return found, i.finish("find", attrs["service"], attrs["username"], start, err)
+}
+
+// GetAttributes returns the attributes of the secret of service and user.
+func (i instance) GetAttributes(service, user string) (map[string]string, error) {
+	p, ok := i.keyring.(attributeKeyring)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	start := begin()
+	attrs, err := p.GetAttributes(i.service(service), user)
+	return attrs, i.finish("get attributes", service, user, start, err)
+}
+
+// UpdateAttributes sets attrs on the secret of service and user.
+func (i instance) UpdateAttributes(service, user string, attrs map[string]string) error {
+	p, ok := i.keyring.(attributeKeyring)
+	if !ok {
+		return ErrUnsupported
+	}
+	start := begin()
+	return i.finish("update attributes", service, user, start, p.UpdateAttributes(i.service(service), user, attrs))
+}
+
+// GetModified returns when the secret of service and user was last changed.
+func (i instance) GetModified(service, user string) (time.Time, error) {
+	p, ok := i.keyring.(modifiedKeyring)
+	if !ok {
+		return time.Time{}, ErrUnsupported
+	}
+	start := begin()
+	modified, err := p.GetModified(i.service(service), user)
+	return modified, i.finish("get modified", service, user, start, err)
+}
+
+// Collections returns the labels of the collections of the underlying
+// keyring.
+func (i instance) Collections() ([]string, error) {
+	p, ok := i.keyring.(collectionKeyring)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return p.Collections()
+}
+
+// ActiveCollection returns the label of the collection the underlying
+// keyring stores secrets in.
+func (i instance) ActiveCollection() (string, error) {
+	p, ok := i.keyring.(collectionKeyring)
+	if !ok {
+		return "", ErrUnsupported
+	}
+	return p.ActiveCollection()
+}
+
+// Lock locks the collection of the underlying keyring.
+func (i instance) Lock() error {
+	p, ok := i.keyring.(locker)
+	if !ok {
+		return ErrUnsupported
+	}
+	return p.Lock()
+}
+
+// inventory returns the metadata of the secrets with the prefix, if the
+// underlying keyring can enumerate them.
+func (i instance) inventory() ([]InventoryItem, error) {
+	p, ok := i.keyring.(inventoryKeyring)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	items, err := p.inventory()
+	if err != nil {
+		return nil, err
+	}
+	return withPrefix(items, i.prefix), nil
+}
+
+// duplicates returns the items stored for service and user if there's more
+// than one and the underlying keyring can hold duplicates.
+func (i instance) duplicates(service, user string) ([]InventoryItem, error) {
+	p, ok := i.keyring.(duplicateKeyring)
+	if !ok {
+		return nil, nil
+	}
+
+	items, err := p.duplicates(i.service(service), user)
+	if err != nil || items == nil {
+		return items, err
+	}
+	return withPrefix(items, i.prefix), nil
+}
+
+// deduplicate deletes all but the newest item stored for service and user.
+func (i instance) deduplicate(service, user string) (int, error) {
+	p, ok := i.keyring.(duplicateKeyring)
+	if !ok {
+		return 0, nil
+	}
+	return p.deduplicate(i.service(service), user)
+}
+
+// SetMany stores the secret of each user in entries under service. If the
+// validator rejects a secret, none are stored.
+func (i instance) SetMany(service string, entries map[string]string) error {
+	for _, user := range sortedUsers(entries) {
+		if err := validate(service, user, entries[user]); err != nil {
+			return &BatchError{User: user, Err: err}
+		}
+	}
+	start := begin()
+	return i.finish("set many", service, "", start, setMany(i.keyring, i.service(service), entries))
+}
+
+// GetMany gets the secrets of the given users of service.
+func (i instance) GetMany(service string, users []string) (map[string]string, error) {
+	start := begin()
+	secrets, err := getMany(i.keyring, i.service(service), users)
+	if err = i.finish("get many", service, "", start, err); err != nil {
+		return secrets, err
+	}
+
+	for n, user := range users {
+		secret, ok := secrets[user]
+		if !ok {
+			continue
+		}
+		secret, err = i.refresh(service, user, secret)
+		if err != nil {
+			return secrets, &BatchError{Succeeded: n, User: user, Err: err}
+		}
+		secrets[user] = secret
+	}
+	return secrets, nil
+}
+
+// DeleteAllMulti deletes all secrets for each of the given services and
+// returns the number deleted per service.
+func (i instance) DeleteAllMulti(services []string) (map[string]int, error) {
+	stored := make([]string, len(services))
+	for n, service := range services {
+		stored[n] = i.service(service)
+	}
+
+	start := begin()
+	deleted, err := deleteAllMulti(i.keyring, stored)
+	if i.prefix != "" {
+		counts := make(map[string]int, len(deleted))
+		for service, n := range deleted {
+			counts[strings.TrimPrefix(service, i.prefix)] = n
+		}
+		deleted = counts
+	}
+	return deleted, i.finish("delete all multi", "", "", start, serviceErrorsWithoutPrefix(err, i.prefix))
+}
+
+// purge deletes the secrets of every service starting with prefix.
+func (i instance) purge(prefix string) (int, error) {
+	start := begin()
+	n, err := purge(i.keyring, i.service(prefix))
+	return n, i.finish("purge", prefix, "", start, serviceErrorsWithoutPrefix(err, i.prefix))
+}
+
+// purgePreview returns the users of every service starting with prefix.
+func (i instance) purgePreview(prefix string) (map[string][]string, error) {
+	start := begin()
+	matches, err := purgeMatches(i.keyring, i.service(prefix))
+	if err = i.finish("purge preview", prefix, "", start, err); err != nil || i.prefix == "" {
+		return matches, err
+	}
+
+	stripped := make(map[string][]string, len(matches))
+	for service, users := range matches {
+		stripped[strings.TrimPrefix(service, i.prefix)] = users
+	}
+	return stripped, nil
+}
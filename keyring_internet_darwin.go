@@ -0,0 +1,199 @@
+package keyring
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/zalando/go-keyring/internal/shellescape"
+)
+
+// macOSXInternetKeychain stores secrets as internet passwords
+// (kSecClassInternetPassword), the item class used by Safari and many other
+// tools, instead of generic passwords.
+type macOSXInternetKeychain struct {
+	protocol string
+	port     int
+}
+
+// KeychainInternetOption configures the provider returned by
+// NewKeychainInternetProvider.
+type KeychainInternetOption func(*macOSXInternetKeychain)
+
+// WithInternetProtocol restricts items to the given protocol, given as the
+// four character code used by the security binary, e.g. "htps" for HTTPS.
+func WithInternetProtocol(protocol string) KeychainInternetOption {
+	return func(k *macOSXInternetKeychain) {
+		k.protocol = protocol
+	}
+}
+
+// WithInternetPort restricts items to the given port.
+func WithInternetPort(port int) KeychainInternetOption {
+	return func(k *macOSXInternetKeychain) {
+		k.port = port
+	}
+}
+
+// NewKeychainInternetProvider returns a Keyring operating on macOS keychain
+// internet passwords. The service is mapped to the server (kSecAttrServer)
+// and the user to the account (kSecAttrAccount) of the item.
+func NewKeychainInternetProvider(opts ...KeychainInternetOption) Keyring {
+	k := macOSXInternetKeychain{}
+	for _, opt := range opts {
+		opt(&k)
+	}
+	return k
+}
+
+// Describe returns the provider and its protocol and port.
+func (k macOSXInternetKeychain) Describe() []ProviderInfo {
+	config := map[string]string{}
+	if k.protocol != "" {
+		config["protocol"] = k.protocol
+	}
+	if k.port != 0 {
+		config["port"] = strconv.Itoa(k.port)
+	}
+	return []ProviderInfo{{Name: "keychain-internet", Config: config}}
+}
+
+// Persistent reports that keychain items survive a reboot.
+func (k macOSXInternetKeychain) Persistent() bool {
+	return true
+}
+
+// args returns the arguments selecting items of server, and of account if
+// it's not empty.
+func (k macOSXInternetKeychain) args(server, account string) []string {
+	args := []string{"-s", server}
+	if account != "" {
+		args = append(args, "-a", account)
+	}
+	if k.protocol != "" {
+		args = append(args, "-r", k.protocol)
+	}
+	if k.port != 0 {
+		args = append(args, "-P", strconv.Itoa(k.port))
+	}
+	return args
+}
+
+// Get gets an internet password from the keychain given a server and account.
+func (k macOSXInternetKeychain) Get(service, username string) (string, error) {
+	args := append([]string{"find-internet-password"}, k.args(service, username)...)
+	out, err := exec.Command(execPathKeychain, append(args, "-w")...).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "could not be found") {
+			err = ErrNotFound
+		}
+		return "", err
+	}
+
+	// passwords stored by earlier versions are encoded like generic passwords
+	return decodePassword(out)
+}
+
+// SetBytes stores binary data as an internet password given a server and
+// account.
+func (k macOSXInternetKeychain) SetBytes(service, username string, data []byte) error {
+	return k.Set(service, username, string(data))
+}
+
+// GetBytes gets binary data stored as an internet password given a server
+// and account.
+func (k macOSXInternetKeychain) GetBytes(service, username string) ([]byte, error) {
+	secret, err := k.Get(service, username)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(secret), nil
+}
+
+// Exists reports whether an internet password is stored for the server and
+// account, without printing it.
+func (k macOSXInternetKeychain) Exists(service, username string) (bool, error) {
+	args := append([]string{"find-internet-password"}, k.args(service, username)...)
+	out, err := exec.Command(execPathKeychain, args...).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "could not be found") {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Set stores an internet password in the keychain given a server and account.
+// Unlike generic passwords, it's stored as is, so other tools using internet
+// passwords, such as Safari, curl and git-credential-osxkeychain, can read
+// it. Quoting it for the interactive security session handles special
+// characters.
+func (k macOSXInternetKeychain) Set(service, username, password string) error {
+	args := k.args(service, username)
+	for i, arg := range args {
+		args[i] = shellescape.Quote(arg)
+	}
+
+	command := fmt.Sprintf("add-internet-password -U %s -w %s\n", strings.Join(args, " "), shellescape.Quote(password))
+	return runInteractive(command)
+}
+
+// Delete deletes an internet password, identified by server & account, from
+// the keychain.
+func (k macOSXInternetKeychain) Delete(service, username string) error {
+	args := append([]string{"delete-internet-password"}, k.args(service, username)...)
+	out, err := exec.Command(execPathKeychain, args...).CombinedOutput()
+	if strings.Contains(string(out), "could not be found") {
+		err = ErrNotFound
+	}
+	return err
+}
+
+// List returns the accounts with an internet password for a given server.
+func (k macOSXInternetKeychain) List(service string) ([]string, error) {
+	items, err := dumpKeychain()
+	if err != nil {
+		return []string{}, err
+	}
+
+	users := []string{}
+	for _, item := range items {
+		if item.class != "inet" || item.attributes["srvr"] != service {
+			continue
+		}
+		if k.protocol != "" && item.attributes["ptcl"] != k.protocol {
+			continue
+		}
+		if k.port != 0 && item.attributes["port"] != fmt.Sprintf("0x%08X", k.port) {
+			continue
+		}
+		users = append(users, item.attributes["acct"])
+	}
+
+	if len(users) == 0 {
+		return users, ErrNotFound
+	}
+	return users, nil
+}
+
+// DeleteAll deletes all internet passwords for a given server
+func (k macOSXInternetKeychain) DeleteAll(service string) error {
+	// if service is empty, do nothing otherwise it might accidentally delete all secrets
+	if service == "" {
+		return ErrNotFound
+	}
+	// Delete each secret in a while loop until there is no more left
+	// under the server
+	args := append([]string{"delete-internet-password"}, k.args(service, "")...)
+	for {
+		out, err := exec.Command(execPathKeychain, args...).CombinedOutput()
+		if strings.Contains(string(out), "could not be found") {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
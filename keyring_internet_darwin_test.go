@@ -0,0 +1,56 @@
+package keyring
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestInternetPassword tests round tripping an internet password item.
+func TestInternetPassword(t *testing.T) {
+	k := NewKeychainInternetProvider(WithInternetProtocol("htps"), WithInternetPort(8443))
+
+	err := k.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	pw, err := k.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	if password != pw {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	// the password is stored as is, for other tools to read
+	out, err := exec.Command(execPathKeychain, "find-internet-password", "-s", service, "-a", user, "-w").Output()
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if got := strings.TrimSuffix(string(out), "\n"); got != password {
+		t.Errorf("Expected the plain password %s, got %s", password, got)
+	}
+
+	// internet passwords are invisible to the generic password provider
+	_, err = macOSXKeychain{}.Get(service, user)
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+
+	err = k.Delete(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	_, err = k.Get(service, user)
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+
+	err = k.Delete(service, user)
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+}
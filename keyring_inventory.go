@@ -0,0 +1,112 @@
+package keyring
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrStopWalk can be returned by the function passed to Walk to stop the
+// walk early without Walk failing.
+var ErrStopWalk = errors.New("stop walk")
+
+// InventoryItem describes a stored secret without its value. Fields a backend
+// doesn't expose are omitted.
+type InventoryItem struct {
+	Service    string            `json:"service"`
+	User       string            `json:"user"`
+	Label      string            `json:"label,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Created    *time.Time        `json:"created,omitempty"`
+	Modified   *time.Time        `json:"modified,omitempty"`
+	// Size is the length of the secret in bytes.
+	Size *int `json:"size,omitempty"`
+}
+
+// inventoryKeyring is implemented by providers which can enumerate their
+// items without reading the secrets.
+type inventoryKeyring interface {
+	inventory() ([]InventoryItem, error)
+}
+
+// duplicateKeyring is implemented by providers which can hold more than one
+// item for the same service and user.
+type duplicateKeyring interface {
+	duplicates(service, user string) ([]InventoryItem, error)
+	deduplicate(service, user string) (int, error)
+}
+
+// Inventory writes a JSON report of all items visible to the active provider
+// to w. The report holds identifiers and metadata only; secret values are
+// never read, so it's safe to share.
+func Inventory(w io.Writer) error {
+	return writeInventory(w, std())
+}
+
+// writeInventory writes the inventory of p as JSON.
+func writeInventory(w io.Writer, p inventoryKeyring) error {
+	items, err := p.inventory()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Items []InventoryItem `json:"items"`
+	}{items})
+}
+
+// Walk calls fn with the service and user of every item visible to the
+// active provider, e.g. to build a keyring browser. It stops at the first
+// error returned by fn and returns it, unless it's ErrStopWalk, in which case
+// Walk returns nil. Secret values are never read. The active provider must
+// be able to enumerate its items, otherwise ErrUnsupported is returned.
+//
+// Items stored by other applications are included where the backend maps
+// them to a service, e.g. Windows credentials by their target name. Items
+// without a service, such as Secret Service items lacking the service
+// attribute, are skipped.
+func Walk(fn func(service, user string) error) error {
+	return walk(std(), fn)
+}
+
+// walk calls fn with the items of p.
+func walk(p inventoryKeyring, fn func(service, user string) error) error {
+	items, err := p.inventory()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.Service == "" {
+			continue
+		}
+		err = fn(item.Service, item.User)
+		if err == ErrStopWalk {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Duplicates returns the items stored for service and user, newest first, if
+// there's more than one, e.g. left behind by Secret Service implementations
+// which created a second item on Set instead of replacing the first. Get
+// reads any one of them. nil is returned if there's no more than one item, or
+// if the active provider stores a single secret per service and user, so
+// can't hold duplicates. Secret values are never read.
+func Duplicates(service, user string) ([]InventoryItem, error) {
+	return std().duplicates(service, user)
+}
+
+// Deduplicate deletes all but the newest, by modification time, of the items
+// stored for service and user, and returns how many were deleted. It does
+// nothing if the active provider can't hold duplicates.
+func Deduplicate(service, user string) (int, error) {
+	return std().deduplicate(service, user)
+}
@@ -0,0 +1,96 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// TestInventory tests that the inventory lists items but no secret values.
+func TestInventory(t *testing.T) {
+	mp := &mockProvider{}
+
+	err := mp.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = mp.SetWithAttributes(service+"2", map[string]string{"username": user, "profile": "work"}, password+"2")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	var buf bytes.Buffer
+	err = writeInventory(&buf, mp)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	if bytes.Contains(buf.Bytes(), []byte(password)) {
+		t.Errorf("Inventory must not contain secret values, got %s", buf.String())
+	}
+
+	var report struct {
+		Items []InventoryItem `json:"items"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &report)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	if len(report.Items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(report.Items))
+	}
+
+	item := report.Items[0]
+	if item.Service != service || item.User != user || item.Size == nil || *item.Size != len(password) {
+		t.Errorf("Unexpected item %+v", item)
+	}
+
+	if report.Items[1].Attributes["profile"] != "work" {
+		t.Errorf("Expected attributes to be reported, got %+v", report.Items[1])
+	}
+}
+
+// TestWalk tests walking all items and stopping early.
+func TestWalk(t *testing.T) {
+	mp := &mockProvider{}
+
+	for _, u := range []string{user, user + "2"} {
+		err := mp.Set(service, u, password)
+		if err != nil {
+			t.Errorf("Should not fail, got: %s", err)
+		}
+	}
+
+	err := mp.Set(service+"2", user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	walked := []string{}
+	err = walk(mp, func(service, user string) error {
+		walked = append(walked, service+"/"+user)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(walked) != 3 || walked[2] != service+"2/"+user {
+		t.Errorf("Expected 3 items, got %v", walked)
+	}
+
+	calls := 0
+	err = walk(mp, func(service, user string) error {
+		calls++
+		return ErrStopWalk
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("Expected the walk to stop after 1 call without error, got %d calls, %v", calls, err)
+	}
+
+	err = walk(mp, func(service, user string) error {
+		return ErrNotFound
+	})
+	assertError(t, err, ErrNotFound)
+}
@@ -0,0 +1,334 @@
+//go:build (dragonfly && cgo) || (freebsd && cgo) || linux || netbsd || openbsd
+
+package keyring
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	kwalletInterface = "org.kde.KWallet"
+	kwalletAppID     = "go-keyring"
+
+	// kwalletStream is the entry type of binary data written by SetBytes.
+	kwalletStream = 2
+)
+
+// kwalletServices are the bus names and object paths of the KWallet daemons
+// of KDE Plasma 6 and 5, tried in that order.
+var kwalletServices = []struct {
+	name string
+	path dbus.ObjectPath
+}{
+	{"org.kde.kwalletd6", "/modules/kwalletd6"},
+	{"org.kde.kwalletd5", "/modules/kwalletd5"},
+}
+
+// kwalletProvider stores secrets in the network wallet of KWallet, with the
+// service as folder and the user as entry key.
+type kwalletProvider struct {
+	conn func() (*dbus.Conn, error)
+}
+
+// NewKWalletProvider returns a Keyring using KWallet through its own D-Bus
+// interface rather than the Secret Service.
+func NewKWalletProvider() Keyring {
+	return kwalletProvider{conn: dbus.SessionBus}
+}
+
+// probeTimeout bounds the probe of the session bus selecting the provider,
+// so a bus which doesn't respond can't hang the first call.
+const probeTimeout = 300 * time.Millisecond
+
+// inKDE reports whether the process runs in a KDE session with KWallet but
+// without a Secret Service, e.g. because gnome-keyring isn't installed. If
+// the session bus doesn't answer within probeTimeout, it reports false, so
+// the Secret Service provider is selected.
+func inKDE() bool {
+	if !strings.Contains(os.Getenv("XDG_CURRENT_DESKTOP"), "KDE") {
+		return false
+	}
+
+	result := make(chan bool, 1)
+	go func() { result <- kwalletOnly() }()
+	select {
+	case ok := <-result:
+		return ok
+	case <-time.After(probeTimeout):
+		return false
+	}
+}
+
+// kwalletOnly reports whether KWallet, but no Secret Service, runs on the
+// session bus. It uses a connection of its own, so a hanging bus doesn't
+// block others waiting for the shared one.
+func kwalletOnly() bool {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	if hasOwner(conn, "org.freedesktop.secrets") {
+		return false
+	}
+	for _, s := range kwalletServices {
+		if hasOwner(conn, s.name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOwner reports whether name is owned on the bus of conn.
+func hasOwner(conn *dbus.Conn, name string) bool {
+	var ok bool
+	err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, name).Store(&ok)
+	return err == nil && ok
+}
+
+// Describe returns the provider.
+func (k kwalletProvider) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "kwallet"}}
+}
+
+// Persistent reports that wallets are stored on disk and survive a reboot.
+func (k kwalletProvider) Persistent() bool {
+	return true
+}
+
+// kwallet is an open handle to the network wallet.
+type kwallet struct {
+	obj    dbus.BusObject
+	handle int32
+}
+
+// open opens the network wallet, which may prompt the user to unlock it.
+func (k kwalletProvider) open() (*kwallet, error) {
+	conn, err := k.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	// fall back to the Plasma 5 daemon, which is started on activation
+	service := kwalletServices[len(kwalletServices)-1]
+	for _, s := range kwalletServices {
+		if hasOwner(conn, s.name) {
+			service = s
+			break
+		}
+	}
+	obj := conn.Object(service.name, service.path)
+
+	var wallet string
+	err = obj.Call(kwalletInterface+".networkWallet", 0).Store(&wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	var handle int32
+	err = obj.Call(kwalletInterface+".open", 0, wallet, int64(0), kwalletAppID).Store(&handle)
+	if err != nil {
+		return nil, err
+	}
+	if handle < 0 {
+		return nil, fmt.Errorf("failed to open wallet %q", wallet)
+	}
+
+	return &kwallet{obj: obj, handle: handle}, nil
+}
+
+// call calls method on the wallet with the handle prepended and the
+// application id appended to args, and stores the result in ret.
+func (w *kwallet) call(method string, ret interface{}, args ...interface{}) error {
+	args = append(append([]interface{}{w.handle}, args...), kwalletAppID)
+	return w.obj.Call(kwalletInterface+"."+method, 0, args...).Store(ret)
+}
+
+// close releases the handle without closing the wallet for other
+// applications.
+func (w *kwallet) close() {
+	var ret int32
+	_ = w.obj.Call(kwalletInterface+".close", 0, w.handle, false, kwalletAppID).Store(&ret)
+}
+
+// hasEntry reports whether the folder service has an entry user.
+func (w *kwallet) hasEntry(service, user string) (bool, error) {
+	var ok bool
+	err := w.call("hasFolder", &ok, service)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = w.call("hasEntry", &ok, service, user)
+	return ok, err
+}
+
+// write calls a method writing to the wallet, which returns 0 on success.
+func (w *kwallet) write(method string, args ...interface{}) error {
+	var ret int32
+	err := w.call(method, &ret, args...)
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return fmt.Errorf("kwallet %s failed with %d", method, ret)
+	}
+	return nil
+}
+
+// Set stores user and pass in the keyring under the defined service name.
+func (k kwalletProvider) Set(service, user, pass string) error {
+	w, err := k.open()
+	if err != nil {
+		return err
+	}
+	defer w.close()
+
+	return w.write("writePassword", service, user, pass)
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (k kwalletProvider) SetBytes(service, user string, data []byte) error {
+	w, err := k.open()
+	if err != nil {
+		return err
+	}
+	defer w.close()
+
+	return w.write("writeEntry", service, user, data, int32(kwalletStream))
+}
+
+// Get gets a secret from the keyring given a service name and a user.
+func (k kwalletProvider) Get(service, user string) (string, error) {
+	data, err := k.GetBytes(service, user)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(data)
+
+	return string(data), nil
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user. Entries written by Set are read as passwords, others as raw data.
+func (k kwalletProvider) GetBytes(service, user string) ([]byte, error) {
+	w, err := k.open()
+	if err != nil {
+		return nil, err
+	}
+	defer w.close()
+
+	ok, err := w.hasEntry(service, user)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var entryType int32
+	err = w.call("entryType", &entryType, service, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if entryType == kwalletStream {
+		var data []byte
+		err = w.call("readEntry", &data, service, user)
+		return data, err
+	}
+
+	var pass string
+	err = w.call("readPassword", &pass, service, user)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(pass), nil
+}
+
+// Exists reports whether a secret is stored for service and user.
+func (k kwalletProvider) Exists(service, user string) (bool, error) {
+	w, err := k.open()
+	if err != nil {
+		return false, err
+	}
+	defer w.close()
+
+	return w.hasEntry(service, user)
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring.
+func (k kwalletProvider) Delete(service, user string) error {
+	w, err := k.open()
+	if err != nil {
+		return err
+	}
+	defer w.close()
+
+	ok, err := w.hasEntry(service, user)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+
+	return w.write("removeEntry", service, user)
+}
+
+// DeleteAll deletes all secrets for a given service
+func (k kwalletProvider) DeleteAll(service string) error {
+	// if service is empty, do nothing otherwise it might accidentally delete all secrets
+	if service == "" {
+		return ErrNotFound
+	}
+
+	w, err := k.open()
+	if err != nil {
+		return err
+	}
+	defer w.close()
+
+	var ok bool
+	err = w.call("hasFolder", &ok, service)
+	if err != nil || !ok {
+		return err
+	}
+
+	return w.call("removeFolder", &ok, service)
+}
+
+// List returns the users with a secret stored for a given service.
+func (k kwalletProvider) List(service string) ([]string, error) {
+	w, err := k.open()
+	if err != nil {
+		return []string{}, err
+	}
+	defer w.close()
+
+	var ok bool
+	err = w.call("hasFolder", &ok, service)
+	if err != nil {
+		return []string{}, err
+	}
+	if !ok {
+		return []string{}, ErrNotFound
+	}
+
+	var users []string
+	err = w.call("entryList", &users, service)
+	if err != nil {
+		return []string{}, err
+	}
+	if len(users) == 0 {
+		return []string{}, ErrNotFound
+	}
+	return users, nil
+}
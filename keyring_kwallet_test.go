@@ -0,0 +1,251 @@
+//go:build (dragonfly && cgo) || (freebsd && cgo) || linux || netbsd || openbsd
+
+package keyring
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+// kwalletEntry is an entry of the fake wallet.
+type kwalletEntry struct {
+	entryType int32
+	value     []byte
+}
+
+// fakeKWallet implements the parts of the KWallet interface used by
+// kwalletProvider, with a single always open wallet.
+type fakeKWallet struct {
+	mu      sync.Mutex
+	folders map[string]map[string]kwalletEntry
+}
+
+func (w *fakeKWallet) NetworkWallet() (string, *dbus.Error) {
+	return "kdewallet", nil
+}
+
+func (w *fakeKWallet) Open(wallet string, wID int64, appID string) (int32, *dbus.Error) {
+	return 1, nil
+}
+
+func (w *fakeKWallet) Close(handle int32, force bool, appID string) (int32, *dbus.Error) {
+	return 0, nil
+}
+
+func (w *fakeKWallet) HasFolder(handle int32, folder, appID string) (bool, *dbus.Error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.folders[folder]
+	return ok, nil
+}
+
+func (w *fakeKWallet) RemoveFolder(handle int32, folder, appID string) (bool, *dbus.Error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.folders, folder)
+	return true, nil
+}
+
+func (w *fakeKWallet) HasEntry(handle int32, folder, key, appID string) (bool, *dbus.Error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.folders[folder][key]
+	return ok, nil
+}
+
+func (w *fakeKWallet) EntryType(handle int32, folder, key, appID string) (int32, *dbus.Error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.folders[folder][key].entryType, nil
+}
+
+func (w *fakeKWallet) EntryList(handle int32, folder, appID string) ([]string, *dbus.Error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	keys := []string{}
+	for key := range w.folders[folder] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (w *fakeKWallet) write(folder, key string, entry kwalletEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.folders[folder] == nil {
+		w.folders[folder] = map[string]kwalletEntry{}
+	}
+	w.folders[folder][key] = entry
+}
+
+func (w *fakeKWallet) WritePassword(handle int32, folder, key, value, appID string) (int32, *dbus.Error) {
+	w.write(folder, key, kwalletEntry{1, []byte(value)})
+	return 0, nil
+}
+
+func (w *fakeKWallet) WriteEntry(handle int32, folder, key string, value []byte, entryType int32, appID string) (int32, *dbus.Error) {
+	w.write(folder, key, kwalletEntry{entryType, value})
+	return 0, nil
+}
+
+func (w *fakeKWallet) ReadPassword(handle int32, folder, key, appID string) (string, *dbus.Error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return string(w.folders[folder][key].value), nil
+}
+
+func (w *fakeKWallet) ReadEntry(handle int32, folder, key, appID string) ([]byte, *dbus.Error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.folders[folder][key].value, nil
+}
+
+func (w *fakeKWallet) RemoveEntry(handle int32, folder, key, appID string) (int32, *dbus.Error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.folders[folder], key)
+	return 0, nil
+}
+
+// startKWallet starts a private dbus-daemon serving a fake Plasma 6 KWallet
+// daemon and returns a client connection to it.
+func startKWallet(t *testing.T) *dbus.Conn {
+	t.Helper()
+
+	connect := startBus(t)
+	server := connect()
+	service := kwalletServices[0]
+
+	// KWallet's methods start with a lower case letter
+	methods := map[string]string{}
+	for _, m := range []string{"NetworkWallet", "Open", "Close", "HasFolder", "RemoveFolder", "HasEntry",
+		"EntryType", "EntryList", "WritePassword", "WriteEntry", "ReadPassword", "ReadEntry", "RemoveEntry"} {
+		methods[m] = strings.ToLower(m[:1]) + m[1:]
+	}
+	wallet := &fakeKWallet{folders: map[string]map[string]kwalletEntry{}}
+	err := server.ExportWithMap(wallet, methods, service.path, kwalletInterface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := server.RequestName(service.name, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", service.name, err)
+	}
+
+	return connect()
+}
+
+// TestKWalletProvider tests storing secrets as wallet entries.
+func TestKWalletProvider(t *testing.T) {
+	client := startKWallet(t)
+	kp := kwalletProvider{conn: func() (*dbus.Conn, error) { return client, nil }}
+
+	_, err := kp.Get(service, user)
+	assertError(t, err, ErrNotFound)
+
+	err = kp.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	pw, err := kp.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	data := []byte{0x00, 0xff, 0x80}
+	err = kp.SetBytes(service, user+"2", data)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	got, err := kp.GetBytes(service, user+"2")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Expected data %x, got %x", data, got)
+	}
+
+	users, err := kp.List(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(users) != 2 || users[0] != user || users[1] != user+"2" {
+		t.Errorf("Expected users %s and %s, got %v", user, user+"2", users)
+	}
+
+	err = kp.Delete(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = kp.Delete(service, user)
+	assertError(t, err, ErrNotFound)
+
+	err = kp.DeleteAll(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	ok, err := kp.Exists(service, user+"2")
+	if err != nil || ok {
+		t.Errorf("Expected secret not to exist, got %t, %v", ok, err)
+	}
+
+	_, err = kp.List(service)
+	assertError(t, err, ErrNotFound)
+}
+
+// TestInKDEUnresponsiveBus tests that a session bus which never answers or
+// doesn't exist doesn't hang the provider selection.
+func TestInKDEUnresponsiveBus(t *testing.T) {
+	t.Setenv("XDG_CURRENT_DESKTOP", "KDE")
+
+	socket := filepath.Join(t.TempDir(), "bus")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// accept the probe's connection but never answer, until the test is done
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	defer func() {
+		select {
+		case c := <-accepted:
+			_ = c.Close()
+		default:
+		}
+	}()
+
+	for _, address := range []string{"unix:path=" + socket, "unix:path=" + socket + "-missing"} {
+		t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+
+		start := time.Now()
+		if inKDE() {
+			t.Errorf("Expected no KWallet on %s", address)
+		}
+		if d := time.Since(start); d > 2*probeTimeout {
+			t.Errorf("Expected the probe of %s to give up after %s, took %s", address, probeTimeout, d)
+		}
+	}
+}
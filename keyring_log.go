@@ -0,0 +1,27 @@
+package keyring
+
+import "time"
+
+// logger is called after every provider call of the package level
+// functions, if set.
+var logger func(op, service, user string, dur time.Duration, err error)
+
+// SetLogger registers fn to be called after each call the package level
+// functions make to the provider, e.g. to record latency and failures in
+// existing logging or tracing. It's given the operation, such as "get" or
+// "delete all", the service and user, which is empty for operations on a
+// whole service, how long the call took and the error returned to the caller,
+// nil on success. Secrets are never passed to fn.
+//
+// Every call of the package level functions reading, storing or deleting
+// secrets or their attributes is reported, including the batch functions such
+// as SetMany and Purge, as are those of the Keyring instances returned by New.
+// The error of the failed entry of a *BatchError and those in ServiceErrors are
+// wrapped in a KeyringError like the error of a single call. fn is called
+// synchronously, so it should return quickly. Passing nil disables logging,
+// which is the default.
+func SetLogger(fn func(op, service, user string, dur time.Duration, err error)) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	logger = fn
+}
@@ -0,0 +1,63 @@
+package keyring
+
+import "time"
+
+// Outcomes of the provider calls passed to the metrics hook.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeNotFound = "not-found"
+	OutcomeError    = "error"
+)
+
+// metrics is called after every provider call of the package level
+// functions, if set.
+var metrics func(op, backend, outcome string, dur time.Duration)
+
+// SetMetrics registers fn to be called after each call the package level
+// functions make to the provider, e.g. to count operations and observe their
+// duration in a metrics system such as Prometheus. It's given the operation
+// as passed to the logger set with SetLogger, the backend, named like the
+// innermost layer returned by Describe, e.g. "secret-service", the outcome,
+// one of OutcomeSuccess, OutcomeNotFound and OutcomeError, and how long the
+// call, including any D-Bus round trips or system calls, took. Services and
+// users aren't passed, so they don't inflate the number of series.
+//
+// fn is called synchronously, so it should return quickly. Passing nil
+// disables metrics, which is the default; neither the clock nor the
+// provider is consulted then.
+func SetMetrics(fn func(op, backend, outcome string, dur time.Duration)) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	metrics = fn
+}
+
+// begin returns the start time of a provider call, or the zero time if no
+// hook would report it.
+func begin() time.Time {
+	providerMu.RLock()
+	enabled := logger != nil || metrics != nil
+	providerMu.RUnlock()
+
+	if !enabled {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// outcome classifies the error of a provider call.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case err == ErrNotFound:
+		return OutcomeNotFound
+	default:
+		return OutcomeError
+	}
+}
+
+// backend returns the name of the innermost layer of k.
+func backend(k Keyring) string {
+	infos := describe(k)
+	return infos[len(infos)-1].Name
+}
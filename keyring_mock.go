@@ -1,71 +1,441 @@
 package keyring
 
+import (
+	"sync"
+	"time"
+)
+
+// mockProvider is an in-memory store that is safe for concurrent use.
 type mockProvider struct {
-	mockStore map[string]map[string]string
+	mu        sync.Mutex
+	mockStore []mockItem
 	mockError error
 }
 
+// mockItem is a secret together with the attributes identifying it. Secrets
+// stored with Set have the service and username attributes.
+type mockItem struct {
+	attributes map[string]string
+	label      string
+	secret     string
+	modified   time.Time
+}
+
+// matches reports whether the item has all of the given attributes.
+func (i mockItem) matches(search map[string]string) bool {
+	for k, v := range search {
+		if i.attributes[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Describe returns the provider.
+func (m *mockProvider) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "mock"}}
+}
+
+// Persistent reports that the in-memory store is lost with the process.
+func (m *mockProvider) Persistent() bool {
+	return false
+}
+
+// search returns the indexes of the items matching all of the given
+// attributes, in insertion order like the Secret Service. Callers must hold
+// m.mu, as must callers of the other unexported helpers.
+func (m *mockProvider) search(search map[string]string) []int {
+	matches := []int{}
+	for i, item := range m.mockStore {
+		if item.matches(search) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// set stores pass in the item with the given attributes, keeping any
+// additional attributes it has. An empty label keeps the label of an
+// existing item.
+func (m *mockProvider) set(attributes map[string]string, pass, label string) error {
+	if m.mockError != nil {
+		return m.mockError
+	}
+	// like the Secret Service, prefer the item with exactly the given
+	// attributes and otherwise update the single one with additional
+	// attributes
+	matches := m.search(attributes)
+	for _, i := range matches {
+		if len(m.mockStore[i].attributes) == len(attributes) {
+			matches = []int{i}
+			break
+		}
+	}
+	if len(matches) > 1 {
+		return ErrMultipleMatches
+	}
+	if len(matches) == 1 {
+		i := matches[0]
+		m.mockStore[i].secret = pass
+		m.mockStore[i].modified = clock()
+		if label != "" {
+			m.mockStore[i].label = label
+		}
+		return nil
+	}
+	m.mockStore = append(m.mockStore, mockItem{attributes: attributes, label: label, secret: pass, modified: clock()})
+	return nil
+}
+
+// remove deletes the item at index i.
+func (m *mockProvider) remove(i int) {
+	m.mockStore = append(m.mockStore[:i], m.mockStore[i+1:]...)
+}
+
 // Set stores user and pass in the keyring under the defined service
 // name.
 func (m *mockProvider) Set(service, user, pass string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.set(map[string]string{"username": user, "service": service}, pass, "")
+}
+
+// SetIfAbsent stores user and pass in the keyring under the defined service
+// name unless a secret is already stored for them.
+func (m *mockProvider) SetIfAbsent(service, user, pass string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.mockError != nil {
 		return m.mockError
 	}
-	if m.mockStore == nil {
-		m.mockStore = make(map[string]map[string]string)
-	}
-	if m.mockStore[service] == nil {
-		m.mockStore[service] = make(map[string]string)
+	if len(m.search(map[string]string{"username": user, "service": service})) > 0 {
+		return ErrAlreadyExists
 	}
-	m.mockStore[service][user] = pass
-	return nil
+	return m.set(map[string]string{"username": user, "service": service}, pass, "")
+}
+
+// SetWithLabel stores user and pass in the keyring under the defined service
+// name, labelled label.
+func (m *mockProvider) SetWithLabel(service, user, pass, label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.set(map[string]string{"username": user, "service": service}, pass, label)
+}
+
+// SetWithAttributes stores pass in the keyring under the defined service
+// name, tagged with the given attributes.
+func (m *mockProvider) SetWithAttributes(service string, attrs map[string]string, pass string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.set(itemAttributes(service, attrs), pass, "")
 }
 
 // Get gets a secret from the keyring given a service name and a user.
 func (m *mockProvider) Get(service, user string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.mockError != nil {
 		return "", m.mockError
 	}
-	if b, ok := m.mockStore[service]; ok {
-		if v, ok := b[user]; ok {
-			return v, nil
-		}
+	if matches := m.search(map[string]string{"username": user, "service": service}); len(matches) > 0 {
+		return m.mockStore[matches[0]].secret, nil
 	}
 	return "", ErrNotFound
 }
 
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (m *mockProvider) SetBytes(service, user string, data []byte) error {
+	return m.Set(service, user, string(data))
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (m *mockProvider) GetBytes(service, user string) ([]byte, error) {
+	secret, err := m.Get(service, user)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(secret), nil
+}
+
+// findItem returns the index of the single item for service matching all of
+// the given attributes.
+func (m *mockProvider) findItem(service string, attrs map[string]string) (int, error) {
+	if m.mockError != nil {
+		return 0, m.mockError
+	}
+	matches := m.search(itemAttributes(service, attrs))
+	switch len(matches) {
+	case 0:
+		return 0, ErrNotFound
+	case 1:
+		return matches[0], nil
+	default:
+		return 0, ErrMultipleMatches
+	}
+}
+
+// GetWithAttributes gets the secret of the single item for service matching
+// all of the given attributes.
+func (m *mockProvider) GetWithAttributes(service string, attrs map[string]string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.findItem(service, attrs)
+	if err != nil {
+		return "", err
+	}
+	return m.mockStore[i].secret, nil
+}
+
+// ExistsWithAttributes reports whether a single item for service matches all
+// of the given attributes.
+func (m *mockProvider) ExistsWithAttributes(service string, attrs map[string]string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.findItem(service, attrs)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Exists reports whether a secret is stored for service and user.
+func (m *mockProvider) Exists(service, user string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mockError != nil {
+		return false, m.mockError
+	}
+	return len(m.search(map[string]string{"username": user, "service": service})) > 0, nil
+}
+
+// Find returns the attributes of all items matching all of the given
+// attributes.
+func (m *mockProvider) Find(attrs map[string]string) ([]map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mockError != nil {
+		return nil, m.mockError
+	}
+	found := []map[string]string{}
+	for _, i := range m.search(attrs) {
+		found = append(found, itemAttributes("", m.mockStore[i].attributes))
+	}
+	return found, nil
+}
+
+// GetAttributes returns the attributes of the item of service and user.
+func (m *mockProvider) GetAttributes(service, user string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mockError != nil {
+		return nil, m.mockError
+	}
+	if matches := m.search(map[string]string{"username": user, "service": service}); len(matches) > 0 {
+		return itemAttributes("", m.mockStore[matches[0]].attributes), nil
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateAttributes sets attrs on the item of service and user, keeping its
+// secret and the attributes identifying it.
+func (m *mockProvider) UpdateAttributes(service, user string, attrs map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mockError != nil {
+		return m.mockError
+	}
+	matches := m.search(map[string]string{"username": user, "service": service})
+	if len(matches) == 0 {
+		return ErrNotFound
+	}
+
+	attributes := map[string]string{}
+	for k, v := range m.mockStore[matches[0]].attributes {
+		attributes[k] = v
+	}
+	for k, v := range attrs {
+		if k != "service" && k != "username" {
+			attributes[k] = v
+		}
+	}
+	m.mockStore[matches[0]].attributes = attributes
+	return nil
+}
+
+// GetModified returns when the item of service and user was last set.
+func (m *mockProvider) GetModified(service, user string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mockError != nil {
+		return time.Time{}, m.mockError
+	}
+	if matches := m.search(map[string]string{"username": user, "service": service}); len(matches) > 0 {
+		return m.mockStore[matches[0]].modified, nil
+	}
+	return time.Time{}, ErrNotFound
+}
+
+// Rename moves the secret of oldUser to newUser in place.
+func (m *mockProvider) Rename(service, oldUser, newUser string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mockError != nil {
+		return m.mockError
+	}
+	matches := m.search(map[string]string{"username": oldUser, "service": service})
+	if len(matches) == 0 {
+		return ErrNotFound
+	}
+	if len(m.search(map[string]string{"username": newUser, "service": service})) > 0 {
+		return ErrAlreadyExists
+	}
+
+	item := &m.mockStore[matches[0]]
+	attributes := make(map[string]string, len(item.attributes))
+	for k, v := range item.attributes {
+		attributes[k] = v
+	}
+	attributes["username"] = newUser
+	item.attributes = attributes
+	item.modified = clock()
+	return nil
+}
+
 // Delete deletes a secret, identified by service & user, from the keyring.
 func (m *mockProvider) Delete(service, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.mockError != nil {
 		return m.mockError
 	}
-	if m.mockStore != nil {
-		if _, ok := m.mockStore[service]; ok {
-			if _, ok := m.mockStore[service][user]; ok {
-				delete(m.mockStore[service], user)
-				return nil
-			}
-		}
+	if matches := m.search(map[string]string{"username": user, "service": service}); len(matches) > 0 {
+		m.remove(matches[0])
+		return nil
 	}
 	return ErrNotFound
 }
 
+// DeleteWithAttributes deletes the single item for service matching all of
+// the given attributes.
+func (m *mockProvider) DeleteWithAttributes(service string, attrs map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.findItem(service, attrs)
+	if err != nil {
+		return err
+	}
+	m.remove(i)
+	return nil
+}
+
+// List returns the users with a secret stored for a given service.
+func (m *mockProvider) List(service string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mockError != nil {
+		return []string{}, m.mockError
+	}
+	users := []string{}
+	for _, i := range m.search(map[string]string{"service": service}) {
+		users = append(users, m.mockStore[i].attributes["username"])
+	}
+	if len(users) == 0 {
+		return users, ErrNotFound
+	}
+	return users, nil
+}
+
 // DeleteAll deletes all secrets for a given service
 func (m *mockProvider) DeleteAll(service string) error {
+	_, err := m.deleteAllCount(service)
+	return err
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted. Like the other providers, it rejects an empty service
+// with ErrNotFound.
+func (m *mockProvider) deleteAllCount(service string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.mockError != nil {
-		return m.mockError
+		return 0, m.mockError
 	}
-	delete(m.mockStore, service)
-	return nil
+	if service == "" {
+		return 0, ErrNotFound
+	}
+	matches := m.search(map[string]string{"service": service})
+	for n := len(matches) - 1; n >= 0; n-- {
+		m.remove(matches[n])
+	}
+	return len(matches), nil
+}
+
+// inventory returns the metadata of all items.
+func (m *mockProvider) inventory() ([]InventoryItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mockError != nil {
+		return nil, m.mockError
+	}
+	items := make([]InventoryItem, 0, len(m.mockStore))
+	for _, item := range m.mockStore {
+		size := len(item.secret)
+		modified := item.modified
+		items = append(items, InventoryItem{
+			Service:    item.attributes["service"],
+			User:       item.attributes["username"],
+			Label:      item.label,
+			Attributes: item.attributes,
+			Modified:   &modified,
+			Size:       &size,
+		})
+	}
+	return items, nil
+}
+
+// NewMockProvider returns an in-memory Keyring which behaves the same on
+// every platform. It's safe for concurrent use.
+func NewMockProvider() Keyring {
+	return &mockProvider{}
 }
 
 // MockInit sets the provider to a mocked memory store
 func MockInit() {
-	provider = &mockProvider{}
+	setProvider(&mockProvider{})
+}
+
+// MockReset clears all secrets of the mocked memory store set by MockInit or
+// MockInitWithError. It does nothing if the provider isn't mocked.
+func MockReset() {
+	if m, ok := Provider().(*mockProvider); ok {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.mockStore = nil
+	}
 }
 
 // MockInitWithError sets the provider to a mocked memory store
 // that returns the given error on all operations
 func MockInitWithError(err error) {
-	provider = &mockProvider{mockError: err}
+	setProvider(&mockProvider{mockError: err})
 }
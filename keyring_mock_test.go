@@ -2,7 +2,11 @@ package keyring
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // TestSet tests setting a user and password in the keyring.
@@ -109,6 +113,24 @@ func TestMockDeleteAll(t *testing.T) {
 	if err != nil {
 		t.Errorf("Should not fail on empty service, got: %s", err)
 	}
+
+	// an empty service name is rejected instead of matching items without
+	// a service
+	err = mp.Set("", user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	n, err := mp.deleteAllCount("")
+	if err != ErrNotFound || n != 0 {
+		t.Errorf("Expected ErrNotFound for an empty service, got %d, %v", n, err)
+	}
+	n, err = instance{keyring: &mp, prefix: "ns/"}.deleteAllCount("")
+	if !errors.Is(err, ErrNotFound) || n != 0 {
+		t.Errorf("Expected ErrNotFound for an empty service with a namespace, got %d, %v", n, err)
+	}
+	if _, err := mp.Get("", user); err != nil {
+		t.Errorf("Expected the secret to be kept, got %v", err)
+	}
 }
 
 func assertError(t *testing.T, err error, expected error) {
@@ -116,3 +138,648 @@ func assertError(t *testing.T, err error, expected error) {
 		t.Errorf("Expected error %s, got %s", expected, err)
 	}
 }
+
+// TestMockAttributeSearch tests that attribute lookups match items having
+// all of the given attributes, like the Secret Service.
+func TestMockAttributeSearch(t *testing.T) {
+	mp := mockProvider{}
+
+	work := map[string]string{"username": user, "profile": "work", "host": "a"}
+	home := map[string]string{"username": user, "profile": "home", "host": "a"}
+
+	err := mp.SetWithAttributes(service, work, password+"work")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = mp.SetWithAttributes(service, home, password+"home")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	// a subset of the attributes matches
+	pw, err := mp.GetWithAttributes(service, map[string]string{"profile": "home"})
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password+"home" {
+		t.Errorf("Expected password %s, got %s", password+"home", pw)
+	}
+
+	// shared attributes are ambiguous
+	_, err = mp.GetWithAttributes(service, map[string]string{"host": "a"})
+	assertError(t, err, ErrMultipleMatches)
+
+	// all given attributes must match
+	_, err = mp.GetWithAttributes(service, map[string]string{"profile": "work", "host": "b"})
+	assertError(t, err, ErrNotFound)
+
+	// attributes are scoped to the service
+	_, err = mp.GetWithAttributes(service+"other", work)
+	assertError(t, err, ErrNotFound)
+
+	// setting the same attributes replaces the secret
+	err = mp.SetWithAttributes(service, work, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	pw, err = mp.GetWithAttributes(service, work)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	err = mp.DeleteWithAttributes(service, map[string]string{"host": "a"})
+	assertError(t, err, ErrMultipleMatches)
+
+	err = mp.DeleteWithAttributes(service, work)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	exists, err := mp.ExistsWithAttributes(service, work)
+	if err != nil || exists {
+		t.Errorf("Expected work profile to be deleted, got %v, %v", exists, err)
+	}
+
+	exists, err = mp.ExistsWithAttributes(service, home)
+	if err != nil || !exists {
+		t.Errorf("Expected home profile to exist, got %v, %v", exists, err)
+	}
+
+	// plain lookups see items with extra attributes too
+	pw, err = mp.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password+"home" {
+		t.Errorf("Expected password %s, got %s", password+"home", pw)
+	}
+
+	// a plain Set replaces the secret of the single item with extra
+	// attributes
+	err = mp.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	pw, err = mp.GetWithAttributes(service, home)
+	if err != nil || pw != password || len(mp.mockStore) != 1 {
+		t.Errorf("Expected password %s in the single item, got %s, %v", password, pw, err)
+	}
+
+	// but can't choose between several
+	err = mp.SetWithAttributes(service, work, password+"work")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	err = mp.Set(service, user, password)
+	assertError(t, err, ErrMultipleMatches)
+}
+
+// TestMockPersistent tests that the in-memory store reports it's lost on
+// reboot, also when wrapped.
+func TestMockPersistent(t *testing.T) {
+	mp := &mockProvider{}
+	if persistent(mp) {
+		t.Errorf("Expected mock provider to not be persistent")
+	}
+
+	if persistent(NewObscuredNamesProvider(mp, []byte("salt"))) {
+		t.Errorf("Expected wrapped mock provider to not be persistent")
+	}
+}
+
+// TestMockList tests listing the users of a service.
+func TestMockList(t *testing.T) {
+	mp := mockProvider{}
+
+	users, err := mp.List(service)
+	assertError(t, err, ErrNotFound)
+	if len(users) != 0 {
+		t.Errorf("Expected no users, got %v", users)
+	}
+
+	for _, u := range []string{user, user + "2"} {
+		err = mp.Set(service, u, password)
+		if err != nil {
+			t.Errorf("Should not fail, got: %s", err)
+		}
+	}
+
+	err = mp.Set(service+"other", user+"3", password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	users, err = mp.List(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(users) != 2 || users[0] != user || users[1] != user+"2" {
+		t.Errorf("Expected users %s and %s, got %v", user, user+"2", users)
+	}
+}
+
+// TestMockConcurrent tests using the mock from several goroutines.
+func TestMockConcurrent(t *testing.T) {
+	mp := NewMockProvider()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			if err := mp.Set(service, u, password); err != nil {
+				t.Errorf("Should not fail, got: %s", err)
+			}
+			if _, err := mp.Get(service, u); err != nil {
+				t.Errorf("Should not fail, got: %s", err)
+			}
+		}(fmt.Sprintf("%s%d", user, i))
+	}
+	wg.Wait()
+
+	users, err := mp.List(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(users) != 10 {
+		t.Errorf("Expected 10 users, got %d", len(users))
+	}
+}
+
+// TestMockReset tests clearing the mocked provider between tests.
+func TestMockReset(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+
+	MockInit()
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	MockReset()
+	_, err = Get(service, user)
+	assertError(t, err, ErrNotFound)
+}
+
+// TestMockExists tests checking for a secret in the mock.
+func TestMockExists(t *testing.T) {
+	mp := mockProvider{}
+
+	ok, err := mp.Exists(service, user)
+	if err != nil || ok {
+		t.Errorf("Expected secret not to exist, got %t, %v", ok, err)
+	}
+
+	err = mp.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	ok, err = mp.Exists(service, user)
+	if err != nil || !ok {
+		t.Errorf("Expected secret to exist, got %t, %v", ok, err)
+	}
+}
+
+// TestMockSetWithLabel tests that labels show up in the inventory.
+func TestMockSetWithLabel(t *testing.T) {
+	mp := &mockProvider{}
+
+	err := mp.SetWithLabel(service, user, password, "My App")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	items, err := mp.inventory()
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(items) != 1 || items[0].Label != "My App" {
+		t.Errorf("Expected a single item labelled My App, got %+v", items)
+	}
+}
+
+// TestMockSetIfAbsent tests that the mock doesn't overwrite existing secrets.
+func TestMockSetIfAbsent(t *testing.T) {
+	mp := mockProvider{}
+
+	err := mp.SetIfAbsent(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = mp.SetIfAbsent(service, user, password+"2")
+	assertError(t, err, ErrAlreadyExists)
+
+	pw, err := mp.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+}
+
+// TestMockSetGetBytes tests binary data in the mock.
+func TestMockSetGetBytes(t *testing.T) {
+	mp := mockProvider{}
+	data := []byte{0x00, 0xff, 0x80}
+
+	err := mp.SetBytes(service, user, data)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	got, err := mp.GetBytes(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("Expected data %x, got %x", data, got)
+	}
+
+	_, err = mp.GetBytes(service, user+"fake")
+	assertError(t, err, ErrNotFound)
+}
+
+// TestMockGetModified tests that the mock records when a secret was set.
+func TestMockGetModified(t *testing.T) {
+	old := clock
+	defer func() { clock = old }()
+
+	set := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return set }
+
+	mp := mockProvider{}
+	err := mp.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	modified, err := mp.GetModified(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if !modified.Equal(set) {
+		t.Errorf("Expected modified %s, got %s", set, modified)
+	}
+
+	_, err = mp.GetModified(service, user+"fake")
+	assertError(t, err, ErrNotFound)
+}
+
+// TestSetProvider tests swapping the provider while it's in use.
+func TestSetProvider(t *testing.T) {
+	old := Provider()
+	defer SetProvider(old)
+
+	mp := NewMockProvider()
+	SetProvider(mp)
+	if Provider() != mp {
+		t.Fatalf("Expected the provider to be replaced")
+	}
+
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = Get(service, user)
+		}()
+		go func() {
+			defer wg.Done()
+			SetProvider(mp)
+		}()
+	}
+	wg.Wait()
+}
+
+// TestProviderLazy tests that the platform's provider is selected on first
+// use rather than on import.
+func TestProviderLazy(t *testing.T) {
+	oldProvider, oldDefault := provider, defaultProvider
+	defer func() { provider, defaultProvider = oldProvider, oldDefault }()
+
+	selected := 0
+	mp := NewMockProvider()
+	provider, defaultProvider = nil, func() Keyring {
+		selected++
+		return mp
+	}
+
+	_, err := Get(service, user)
+	assertError(t, err, ErrNotFound)
+	if Provider() != mp || selected != 1 {
+		t.Errorf("Expected the provider to be selected once, got %d selections", selected)
+	}
+
+	// a provider set before first use is kept
+	provider, selected = nil, 0
+	SetProvider(&mockProvider{})
+	if Provider() == mp || selected != 0 {
+		t.Errorf("Expected the provider set with SetProvider to be kept")
+	}
+}
+
+// TestKeyringError tests that backend errors are wrapped with the operation,
+// service and user, while the package's errors are returned as is.
+func TestKeyringError(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+
+	mockErr := errors.New("mock error")
+	MockInitWithError(mockErr)
+
+	err := Set(service, user, password)
+	var kerr *KeyringError
+	if !errors.As(err, &kerr) {
+		t.Fatalf("Expected a KeyringError, got %v", err)
+	}
+	if kerr.Op != "set" || kerr.Service != service || kerr.User != user || !errors.Is(err, mockErr) {
+		t.Errorf("Expected set of %s for %s wrapping the mock error, got %+v", service, user, kerr)
+	}
+
+	MockInit()
+	_, err = Get(service, user)
+	assertError(t, err, ErrNotFound)
+}
+
+// TestRenameFallback tests renaming through providers which can't rename in
+// place.
+func TestRenameFallback(t *testing.T) {
+	op := NewObscuredNamesProvider(&mockProvider{}, []byte("salt"))
+
+	err := op.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = rename(op, service, user, user+"renamed")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	_, err = op.Get(service, user)
+	assertError(t, err, ErrNotFound)
+
+	pw, err := op.Get(service, user+"renamed")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+}
+
+// TestGetBytesWipe tests that the caller owns the slice returned by GetBytes,
+// so wiping it leaves the stored secret intact.
+func TestGetBytesWipe(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+
+	MockInit()
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	data, err := GetBytes(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	wipe(data)
+	for _, b := range data {
+		if b != 0 {
+			t.Fatalf("Expected the data to be wiped, got %x", data)
+		}
+	}
+
+	pw, err := Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+}
+
+// TestSetNamespace tests that services are kept within the namespace.
+func TestSetNamespace(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+	defer SetNamespace("")
+
+	mp := &mockProvider{}
+	provider = mp
+
+	err := mp.Set(service, user, password+"outside")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	SetNamespace("plugin/")
+
+	err = Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	pw, err := mp.Get("plugin/"+service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected the secret to be stored in the namespace, got %s, %v", pw, err)
+	}
+
+	pw, err = Get(service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+
+	walked := []string{}
+	err = Walk(func(service, user string) error {
+		walked = append(walked, service)
+		return nil
+	})
+	if err != nil || len(walked) != 1 || walked[0] != service {
+		t.Errorf("Expected to walk only %s, got %v, %v", service, walked, err)
+	}
+
+	err = DeleteAll(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	pw, err = mp.Get(service, user)
+	if err != nil || pw != password+"outside" {
+		t.Errorf("Expected the secret outside the namespace to be kept, got %s, %v", pw, err)
+	}
+}
+
+// TestSetLogger tests reporting provider calls to the logger.
+func TestSetLogger(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+	defer SetLogger(nil)
+
+	provider = &mockProvider{}
+
+	logged := []string{}
+	SetLogger(func(op, service, user string, dur time.Duration, err error) {
+		logged = append(logged, fmt.Sprintf("%s %s %s %v", op, service, user, err))
+	})
+
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	_, err = Get(service, user+"2")
+	assertError(t, err, ErrNotFound)
+	err = DeleteAll(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	expected := []string{
+		"set test-service test-user <nil>",
+		"get test-service test-user2 " + ErrNotFound.Error(),
+		"delete all test-service  <nil>",
+	}
+	if strings.Join(logged, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected calls %q, got %q", expected, logged)
+	}
+	for _, l := range logged {
+		if strings.Contains(l, password) {
+			t.Errorf("Expected the secret not to be logged, got %q", l)
+		}
+	}
+}
+
+// TestSetLoggerBatch tests reporting the calls of the batch and attribute
+// functions to the logger.
+func TestSetLoggerBatch(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+	defer SetLogger(nil)
+
+	provider = &mockProvider{}
+
+	logged := []string{}
+	SetLogger(func(op, service, user string, dur time.Duration, err error) {
+		logged = append(logged, op+" "+service+" "+user)
+	})
+
+	err := SetMany(service, map[string]string{user: password})
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	_, err = GetAll(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	_, err = GetWithAttributes(service, map[string]string{"username": user})
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	_, err = Purge(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	expected := []string{
+		"set many test-service ",
+		"list test-service ",
+		"get many test-service ",
+		"get with attributes test-service test-user",
+		"purge test-service ",
+	}
+	if strings.Join(logged, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected calls %q, got %q", expected, logged)
+	}
+
+	mockErr := errors.New("backend failure")
+	provider = &mockProvider{mockError: mockErr}
+	err = SetMany(service, map[string]string{user: password})
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("Expected a *BatchError, got %T: %v", err, err)
+	}
+	kerr, ok := batchErr.Err.(*KeyringError)
+	if !ok || kerr.Op != "set many" || kerr.User != user || !errors.Is(err, mockErr) {
+		t.Errorf("Expected the failed entry to be wrapped, got %v", batchErr.Err)
+	}
+}
+
+// TestSettingsConcurrent tests changing the settings while other goroutines
+// use the keyring, which the race detector checks.
+func TestSettingsConcurrent(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+	defer SetLogger(nil)
+	defer SetMetrics(nil)
+	defer SetValidator(nil)
+	defer SetMaxSecretLength(0)
+	defer SetNamespace("")
+
+	provider = &mockProvider{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetLogger(func(op, service, user string, dur time.Duration, err error) {})
+			SetMetrics(func(op, backend, outcome string, dur time.Duration) {})
+			SetValidator(func(service, user, pass string) error { return nil })
+			SetMaxSecretLength(100)
+			SetNamespace("app/")
+		}()
+		go func() {
+			defer wg.Done()
+			if err := Set(service, user, password); err != nil {
+				t.Errorf("Should not fail, got: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestSetMetrics tests reporting provider calls to the metrics hook.
+func TestSetMetrics(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+	defer SetMetrics(nil)
+
+	provider = &mockProvider{}
+
+	observed := []string{}
+	SetMetrics(func(op, backend, outcome string, dur time.Duration) {
+		observed = append(observed, op+" "+backend+" "+outcome)
+	})
+
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	_, err = Get(service, user+"2")
+	assertError(t, err, ErrNotFound)
+	err = SetIfAbsent(service, user, password)
+	assertError(t, err, ErrAlreadyExists)
+
+	expected := []string{
+		"set mock success",
+		"get mock not-found",
+		"set if absent mock error",
+	}
+	if strings.Join(observed, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected observations %q, got %q", expected, observed)
+	}
+}
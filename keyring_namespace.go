@@ -0,0 +1,54 @@
+package keyring
+
+import "strings"
+
+// namespace is prepended to every service by the package level functions.
+var namespace string
+
+// SetNamespace makes the package level functions prepend prefix to every
+// service they're given, so components sharing a process are kept apart even
+// if they use the same service names. DeleteAll and Purge only delete secrets
+// within the namespace, and Walk, Inventory and Export only see those, with
+// prefix removed from their services. Find and the attributes it and
+// GetAttributes return use the stored services, including prefix. Passing
+// "" removes the namespace, which is the default.
+//
+// Secrets stored before the namespace was set aren't moved into it. Like the
+// other settings, it applies to the whole process.
+func SetNamespace(prefix string) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	namespace = prefix
+}
+
+// withPrefix returns the items whose services start with prefix, with prefix
+// removed.
+func withPrefix(items []InventoryItem, prefix string) []InventoryItem {
+	if prefix == "" {
+		return items
+	}
+
+	filtered := make([]InventoryItem, 0, len(items))
+	for _, item := range items {
+		if item.Service != prefix && strings.HasPrefix(item.Service, prefix) {
+			item.Service = strings.TrimPrefix(item.Service, prefix)
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+// serviceErrorsWithoutPrefix removes prefix from the services of err if it's
+// a ServiceErrors.
+func serviceErrorsWithoutPrefix(err error, prefix string) error {
+	errs, ok := err.(ServiceErrors)
+	if !ok || prefix == "" {
+		return err
+	}
+
+	stripped := make(ServiceErrors, len(errs))
+	for service, err := range errs {
+		stripped[strings.TrimPrefix(service, prefix)] = err
+	}
+	return stripped
+}
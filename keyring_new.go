@@ -0,0 +1,117 @@
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Option configures the Keyring returned by New.
+type Option func(*options)
+
+type options struct {
+	backend    string
+	collection string
+	namespace  string
+	attempts   int
+	backoff    time.Duration
+	retryOpts  []RetryOption
+}
+
+// backends maps the names accepted by WithBackend to the constructors of
+// their providers. Platforms add their own backends on init.
+var backends = map[string]func() Keyring{
+	"env":  NewEnvProvider,
+	"mock": NewMockProvider,
+}
+
+// collectionBackend returns the provider storing secrets in the named
+// collection, nil on platforms whose keyring has no collections.
+var collectionBackend func(name string) Keyring
+
+// WithBackend selects the backend by the name its provider is described by,
+// e.g. "secret-service", "kwallet", "pass", "keychain", "credential-manager",
+// "dir", "env" or "mock", or "portal" for the file provider keyed by the
+// Flatpak secret portal. The platform's default is selected like on first
+// use of the package level functions otherwise.
+func WithBackend(name string) Option {
+	return func(o *options) {
+		o.backend = name
+	}
+}
+
+// WithCollection stores secrets in the Secret Service collection with the
+// given alias or label, like NewSecretServiceProviderWithCollection.
+func WithCollection(name string) Option {
+	return func(o *options) {
+		o.collection = name
+	}
+}
+
+// WithNamespace prepends prefix to every service, like SetNamespace does for
+// the package level functions, but only for the returned Keyring.
+func WithNamespace(prefix string) Option {
+	return func(o *options) {
+		o.namespace = prefix
+	}
+}
+
+// WithRetries retries failing calls like NewRetryProvider.
+func WithRetries(attempts int, backoff time.Duration, opts ...RetryOption) Option {
+	return func(o *options) {
+		o.attempts = attempts
+		o.backoff = backoff
+		o.retryOpts = opts
+	}
+}
+
+// New returns a Keyring configured by opts, e.g. to inject it into the
+// components of an application, or to use several configurations in one
+// process. Without options it uses the provider the package level functions
+// would select; installing a Keyring with SetProvider makes them use it
+// instead. ErrUnsupported is wrapped by the error returned for a backend
+// which doesn't exist on the platform, or a collection given for a backend
+// without collections.
+//
+// The Keyring behaves like the package level functions: secrets are checked
+// by the validator and the maximum length, calls are reported to the logger
+// and the metrics hook, and Get renews secrets with the registered
+// refreshers. It also supports the optional features of its backend, such as
+// attributes, labels, Rename and Copy, so it can be type asserted to the
+// interfaces of those methods, and Capabilities, Inventory and the other
+// functions inspecting the active provider work once it's installed with
+// SetProvider. Its own calls ignore SetNamespace; use WithNamespace instead.
+func New(opts ...Option) (Keyring, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var k Keyring
+	switch {
+	case o.collection != "":
+		if collectionBackend == nil || (o.backend != "" && o.backend != "secret-service") {
+			return nil, fmt.Errorf("collections with backend %q: %w", o.backend, ErrUnsupported)
+		}
+		k = collectionBackend(o.collection)
+	case o.backend == "":
+		k = selectProvider()
+	case o.backend == "dir":
+		dir := runtimeDir()
+		if dir == "" {
+			return nil, errors.New("dir backend needs $XDG_RUNTIME_DIR, use NewDirProvider instead")
+		}
+		k = NewDirProvider(dir)
+	default:
+		newBackend, ok := backends[o.backend]
+		if !ok {
+			return nil, fmt.Errorf("backend %q: %w", o.backend, ErrUnsupported)
+		}
+		k = newBackend()
+	}
+
+	if o.attempts > 0 {
+		k = NewRetryProvider(k, o.attempts, o.backoff, o.retryOpts...)
+	}
+	return instance{keyring: k, prefix: o.namespace}, nil
+}
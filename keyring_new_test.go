@@ -0,0 +1,132 @@
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNew tests configuring a Keyring instance with options.
+func TestNew(t *testing.T) {
+	k, err := New(WithBackend("mock"), WithNamespace("app/"), WithRetries(3, time.Millisecond))
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	names := []string{}
+	for _, info := range describe(k) {
+		names = append(names, info.Name)
+	}
+	if strings.Join(names, ",") != "namespace,retry,mock" {
+		t.Errorf("Expected the namespace, retry and mock providers, got %v", names)
+	}
+
+	err = k.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	pw, err := k.Get(service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+
+	for _, opts := range [][]Option{
+		{WithBackend("missing")},
+		{WithBackend("mock"), WithCollection("work")},
+	} {
+		_, err = New(opts...)
+		if !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Expected ErrUnsupported, got %v", err)
+		}
+	}
+}
+
+// TestNamespacedProvider tests that instances with different namespaces
+// sharing a backend keep their secrets apart.
+func TestNamespacedProvider(t *testing.T) {
+	m := NewMockProvider()
+	a := instance{keyring: m, prefix: "a/"}
+	b := instance{keyring: m, prefix: "b/"}
+
+	for k, secret := range map[Keyring]string{a: password, b: password + "2"} {
+		if err := k.Set(service, user, secret); err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+	}
+
+	pw, err := a.Get(service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+
+	var buf bytes.Buffer
+	err = writeInventory(&buf, a)
+	if err != nil || strings.Count(buf.String(), `"service": "`+service+`"`) != 1 {
+		t.Errorf("Expected the inventory to hold the secret of a only, got %s, %v", buf.String(), err)
+	}
+
+	n, err := deleteAllCount(b, service)
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 secret deleted, got %d, %v", n, err)
+	}
+	if ok, _ := a.Exists(service, user); !ok {
+		t.Errorf("Expected the secret of a to be kept")
+	}
+}
+
+// TestNewHooks tests that instances apply the package settings and pass the
+// optional features of their backend through.
+func TestNewHooks(t *testing.T) {
+	k, err := New(WithBackend("mock"), WithNamespace("app/"), WithRetries(2, time.Millisecond))
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	SetMaxSecretLength(4)
+	defer SetMaxSecretLength(0)
+	err = k.Set(service, user, password)
+	if !errors.Is(err, ErrSecretTooLong) {
+		t.Errorf("Expected ErrSecretTooLong, got %v", err)
+	}
+	SetMaxSecretLength(0)
+
+	var ops []string
+	SetLogger(func(op, service, user string, dur time.Duration, err error) {
+		ops = append(ops, op)
+	})
+	defer SetLogger(nil)
+
+	if err = k.Set(service, user, password); err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if strings.Join(ops, ",") != "set" {
+		t.Errorf("Expected the set to be logged, got %v", ops)
+	}
+
+	if !capabilities(k).Has(CapabilityAttributes | CapabilityModified | CapabilityInventory) {
+		t.Errorf("Expected the capabilities of the mock, got %b", capabilities(k))
+	}
+	attrs, err := k.(attributeKeyring).GetAttributes(service, user)
+	if err != nil || attrs["service"] != "app/"+service {
+		t.Errorf("Expected the attributes of the namespaced secret, got %v, %v", attrs, err)
+	}
+	err = k.(renamer).Rename(service, user, "renamed")
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	// installed, the instance isn't validated and logged twice
+	old := Provider()
+	SetProvider(k)
+	defer SetProvider(old)
+	ops = nil
+	pw, err := Get(service, "renamed")
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+	if strings.Join(ops, ",") != "get" {
+		t.Errorf("Expected the get to be logged once, got %v", ops)
+	}
+}
@@ -0,0 +1,103 @@
+package keyring
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// obscuredNamesProvider stores secrets in an underlying keyring under
+// HMACed service and user names.
+type obscuredNamesProvider struct {
+	keyring Keyring
+	salt    []byte
+}
+
+// NewObscuredNamesProvider returns a Keyring which stores secrets in k under
+// service and user names replaced by their HMAC-SHA256 keyed with salt. The
+// names stored in the backend are unguessable without the salt, but stay
+// deterministic so the owning application can still look its secrets up.
+//
+// Only the names are obscured: the secret values are stored unchanged and
+// remain readable by anyone who can enumerate the backend's items.
+func NewObscuredNamesProvider(k Keyring, salt []byte) Keyring {
+	return obscuredNamesProvider{
+		keyring: k,
+		salt:    append([]byte(nil), salt...),
+	}
+}
+
+// Describe returns the provider chain with the salt redacted.
+func (o obscuredNamesProvider) Describe() []ProviderInfo {
+	info := ProviderInfo{Name: "obscured-names", Config: map[string]string{"salt": redacted}}
+	return append([]ProviderInfo{info}, describe(o.keyring)...)
+}
+
+// Persistent reports whether the underlying keyring survives a reboot.
+func (o obscuredNamesProvider) Persistent() bool {
+	return persistent(o.keyring)
+}
+
+// obscure returns the hex encoded HMAC of name.
+func (o obscuredNamesProvider) obscure(name string) string {
+	mac := hmac.New(sha256.New, o.salt)
+	mac.Write([]byte(name))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Set stores user and pass in the keyring under the obscured service name.
+func (o obscuredNamesProvider) Set(service, user, pass string) error {
+	return o.keyring.Set(o.obscure(service), o.obscure(user), pass)
+}
+
+// Get gets a secret from the keyring given a service name and a user.
+func (o obscuredNamesProvider) Get(service, user string) (string, error) {
+	return o.keyring.Get(o.obscure(service), o.obscure(user))
+}
+
+// SetBytes stores binary data under the obscured service and user.
+func (o obscuredNamesProvider) SetBytes(service, user string, data []byte) error {
+	return o.keyring.SetBytes(o.obscure(service), o.obscure(user), data)
+}
+
+// GetBytes gets binary data stored under the obscured service and user.
+func (o obscuredNamesProvider) GetBytes(service, user string) ([]byte, error) {
+	return o.keyring.GetBytes(o.obscure(service), o.obscure(user))
+}
+
+// Exists reports whether a secret is stored for the obscured service and user.
+func (o obscuredNamesProvider) Exists(service, user string) (bool, error) {
+	return o.keyring.Exists(o.obscure(service), o.obscure(user))
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring.
+func (o obscuredNamesProvider) Delete(service, user string) error {
+	return o.keyring.Delete(o.obscure(service), o.obscure(user))
+}
+
+// DeleteAll deletes all secrets for a given service
+func (o obscuredNamesProvider) DeleteAll(service string) error {
+	// keep the empty service guard of the underlying providers
+	if service == "" {
+		return o.keyring.DeleteAll("")
+	}
+	return o.keyring.DeleteAll(o.obscure(service))
+}
+
+// List isn't supported as the obscured user names can't be reversed.
+func (o obscuredNamesProvider) List(service string) ([]string, error) {
+	return []string{}, ErrUnsupported
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted, if the underlying keyring can count them.
+func (o obscuredNamesProvider) deleteAllCount(service string) (int, error) {
+	c, ok := o.keyring.(deleteAllCounter)
+	if !ok {
+		return 0, o.DeleteAll(service)
+	}
+	if service == "" {
+		return c.deleteAllCount("")
+	}
+	return c.deleteAllCount(o.obscure(service))
+}
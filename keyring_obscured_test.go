@@ -0,0 +1,67 @@
+package keyring
+
+import "testing"
+
+// TestObscuredNamesRoundTrip tests storing and reading back a secret under
+// obscured names.
+func TestObscuredNamesRoundTrip(t *testing.T) {
+	mp := &mockProvider{}
+	op := NewObscuredNamesProvider(mp, []byte("salt"))
+
+	err := op.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	pw, err := op.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	if password != pw {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	if _, err := mp.Get(service, user); err != ErrNotFound {
+		t.Errorf("Expected names to be obscured in the backend")
+	}
+
+	_, err = NewObscuredNamesProvider(mp, []byte("other")).Get(service, user)
+	assertError(t, err, ErrNotFound)
+
+	err = op.Delete(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	_, err = op.Get(service, user)
+	assertError(t, err, ErrNotFound)
+}
+
+// TestObscuredNamesDeleteAll tests deleting all secrets for an obscured
+// service.
+func TestObscuredNamesDeleteAll(t *testing.T) {
+	mp := &mockProvider{}
+	op := NewObscuredNamesProvider(mp, []byte("salt"))
+
+	err := op.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = op.Set(service, user+"2", password+"2")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = op.DeleteAll(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	_, err = op.Get(service, user)
+	assertError(t, err, ErrNotFound)
+
+	_, err = op.Get(service, user+"2")
+	assertError(t, err, ErrNotFound)
+}
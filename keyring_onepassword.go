@@ -0,0 +1,291 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	execPathOp = "op"
+
+	// opReferencePrefix starts 1Password secret references, which Get reads
+	// directly.
+	opReferencePrefix = "op://"
+
+	// opPasswordField and opBase64Field are the labels of the fields holding
+	// the secret, the latter base64 encoded if it isn't valid UTF-8.
+	opPasswordField = "password"
+	opBase64Field   = "password_base64"
+)
+
+// onePasswordProvider stores secrets as password items of a 1Password vault
+// through the op CLI, titled service/user.
+type onePasswordProvider struct {
+	vault string
+}
+
+// NewOnePasswordProvider returns a Keyring storing secrets as password items
+// of the 1Password vault with the given name or ID, titled service/user, by
+// running the 1Password CLI op. It needs an authenticated op session, e.g.
+// through the desktop app integration or $OP_SERVICE_ACCOUNT_TOKEN.
+//
+// Get also reads secret references such as "op://vault/item/field" given as
+// service, ignoring user, so items created in 1Password can be read as well.
+// Users may not contain a slash. Secrets are passed to op on stdin, never as
+// arguments, and titles after "--" or as the value of --title, so services
+// starting with a dash aren't taken for options. As op can't replace the secret of an item from stdin, Set
+// deletes an existing item before creating the new one. The provider is
+// never selected automatically; install it with SetProvider.
+func NewOnePasswordProvider(vault string) Keyring {
+	return onePasswordProvider{vault: vault}
+}
+
+// opItem is the part of an item as printed by op in JSON format which the
+// provider needs.
+type opItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Vault struct {
+		ID string `json:"id"`
+	} `json:"vault"`
+	Fields []struct {
+		Label string `json:"label"`
+	} `json:"fields"`
+}
+
+// opField is a field of an item template.
+type opField struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Purpose string `json:"purpose,omitempty"`
+	Label   string `json:"label"`
+	Value   string `json:"value"`
+}
+
+// Describe returns the provider with the vault.
+func (o onePasswordProvider) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "1password", Config: map[string]string{"vault": o.vault}}}
+}
+
+// Persistent reports that 1Password keeps secrets across reboots.
+func (o onePasswordProvider) Persistent() bool {
+	return true
+}
+
+// title returns the title of the item of service and user.
+func (o onePasswordProvider) title(service, user string) (string, error) {
+	if user == "" || strings.Contains(user, "/") {
+		return "", fmt.Errorf("invalid 1password user %q", user)
+	}
+	if service == "" {
+		return "", fmt.Errorf("invalid 1password service %q", service)
+	}
+	return service + "/" + user, nil
+}
+
+// run runs op with args and stdin, and returns its output. ErrNotFound is
+// returned if op reports a missing item, otherwise the error includes what op
+// printed to stderr.
+func (o onePasswordProvider) run(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command(execPathOp, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "isn't an item") {
+			return nil, ErrNotFound
+		}
+		if msg != "" {
+			return nil, fmt.Errorf("%s: %w", msg, err)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// item returns the item of service and user, without its secret.
+func (o onePasswordProvider) item(service, user string) (opItem, error) {
+	title, err := o.title(service, user)
+	if err != nil {
+		return opItem{}, err
+	}
+
+	out, err := o.run(nil, "item", "get", "--vault", o.vault, "--format", "json", "--", title)
+	if err != nil {
+		return opItem{}, err
+	}
+
+	var item opItem
+	err = json.Unmarshal(out, &item)
+	return item, err
+}
+
+// Set stores user and pass in the keyring under the defined service name.
+func (o onePasswordProvider) Set(service, user, pass string) error {
+	return o.create(service, user, opPasswordField, pass)
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (o onePasswordProvider) SetBytes(service, user string, data []byte) error {
+	if utf8.Valid(data) {
+		return o.create(service, user, opPasswordField, string(data))
+	}
+	return o.create(service, user, opBase64Field, base64.StdEncoding.EncodeToString(data))
+}
+
+// create replaces the item of service and user by one holding value in the
+// field with the given label.
+func (o onePasswordProvider) create(service, user, label, value string) error {
+	title, err := o.title(service, user)
+	if err != nil {
+		return err
+	}
+
+	err = o.Delete(service, user)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	field := opField{ID: label, Type: "CONCEALED", Label: label, Value: value}
+	if label == opPasswordField {
+		field.Purpose = "PASSWORD"
+	}
+	template, err := json.Marshal(map[string]interface{}{
+		"fields": []opField{field},
+	})
+	if err != nil {
+		return err
+	}
+	defer wipe(template)
+
+	_, err = o.run(template, "item", "create", "--vault", o.vault, "--category", "password", "--title="+title, "-")
+	return err
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user, or the value of the secret reference given as service.
+func (o onePasswordProvider) GetBytes(service, user string) ([]byte, error) {
+	if strings.HasPrefix(service, opReferencePrefix) {
+		return o.run(nil, "read", "--no-newline", service)
+	}
+
+	item, err := o.item(service, user)
+	if err != nil {
+		return nil, err
+	}
+
+	label := opPasswordField
+	for _, f := range item.Fields {
+		if f.Label == opBase64Field {
+			label = opBase64Field
+		}
+	}
+
+	reference := opReferencePrefix + item.Vault.ID + "/" + item.ID + "/" + label
+	data, err := o.run(nil, "read", "--no-newline", reference)
+	if err != nil || label != opBase64Field {
+		return data, err
+	}
+	defer wipe(data)
+
+	return base64.StdEncoding.DecodeString(string(data))
+}
+
+// Get gets a secret from the keyring given a service name and a user, or the
+// value of the secret reference given as service.
+func (o onePasswordProvider) Get(service, user string) (string, error) {
+	data, err := o.GetBytes(service, user)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(data)
+
+	return string(data), nil
+}
+
+// Exists reports whether a secret is stored for service and user, by
+// looking up its item without reading the secret.
+func (o onePasswordProvider) Exists(service, user string) (bool, error) {
+	_, err := o.item(service, user)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring.
+func (o onePasswordProvider) Delete(service, user string) error {
+	title, err := o.title(service, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.run(nil, "item", "delete", "--vault", o.vault, "--", title)
+	return err
+}
+
+// DeleteAll deletes all secrets for a given service
+func (o onePasswordProvider) DeleteAll(service string) error {
+	_, err := o.deleteAllCount(service)
+	return err
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted.
+func (o onePasswordProvider) deleteAllCount(service string) (int, error) {
+	// if service is empty, do nothing otherwise it might accidentally delete all secrets
+	if service == "" {
+		return 0, ErrNotFound
+	}
+
+	users, err := o.List(service)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for i, user := range users {
+		err = o.Delete(service, user)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(users), nil
+}
+
+// List returns the users with a secret stored for a given service.
+func (o onePasswordProvider) List(service string) ([]string, error) {
+	out, err := o.run(nil, "item", "list", "--vault", o.vault, "--categories", "password", "--format", "json")
+	if err != nil {
+		return []string{}, err
+	}
+
+	var items []opItem
+	err = json.Unmarshal(out, &items)
+	if err != nil {
+		return []string{}, err
+	}
+
+	users := []string{}
+	for _, item := range items {
+		user := strings.TrimPrefix(item.Title, service+"/")
+		if user != item.Title && user != "" && !strings.Contains(user, "/") {
+			users = append(users, user)
+		}
+	}
+	if len(users) == 0 {
+		return users, ErrNotFound
+	}
+	return users, nil
+}
@@ -0,0 +1,145 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package keyring
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeOp stands in for op, storing item templates unencrypted in
+// $OP_FAKE_DIR, named by their titles with slashes replaced by percent signs.
+// Like op, it takes the title after "--" as the last argument or from
+// --title, and fails on options it doesn't know.
+const fakeOp = `#!/bin/sh
+dir=$OP_FAKE_DIR
+missing() { echo "\"$1\" isn't an item in the \"test\" vault." >&2; exit 1; }
+for title; do :; done
+skip=
+for arg; do
+	if [ -n "$skip" ]; then skip=; continue; fi
+	case $arg in
+	--) break ;;
+	--vault|--format|--categories|--category) skip=1 ;;
+	--title=*) title=${arg#--title=} ;;
+	--no-newline|-) ;;
+	-*) echo "unknown flag: $arg" >&2; exit 1 ;;
+	esac
+done
+case "$1 $2" in
+"item get")
+	f="$dir/$(echo "$title" | tr / %)"
+	[ -f "$f" ] || missing "$title"
+	printf '{"id":"%s","title":"%s","vault":{"id":"v"},' "$(basename "$f")" "$title"
+	sed 's/^{//' "$f" ;;
+"item create") cat > "$dir/$(echo "$title" | tr / %)" ;;
+"item delete")
+	f="$dir/$(echo "$title" | tr / %)"
+	[ -f "$f" ] || missing "$title"
+	rm "$f" ;;
+"item list")
+	printf '['; sep=
+	for f in "$dir"/*; do
+		[ -e "$f" ] || continue
+		printf '%s{"title":"%s"}' "$sep" "$(basename "$f" | tr % /)"; sep=,
+	done
+	printf ']' ;;
+"read --no-newline")
+	f="$dir/$(echo "$3" | cut -d/ -f4)"
+	[ -f "$f" ] || missing "$3"
+	sed 's/.*"value":"\([^"]*\)".*/\1/' "$f" | tr -d '\n' ;;
+esac
+`
+
+// TestOnePasswordProvider tests storing secrets as items of a 1Password
+// vault.
+func TestOnePasswordProvider(t *testing.T) {
+	bin := t.TempDir()
+	err := os.WriteFile(filepath.Join(bin, "op"), []byte(fakeOp), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("OP_FAKE_DIR", t.TempDir())
+
+	op := NewOnePasswordProvider("test")
+
+	_, err = op.Get(service, user)
+	assertError(t, err, ErrNotFound)
+
+	err = op.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	// replacing the item
+	err = op.Set(service, user, password+"2")
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	pw, err := op.Get(service, user)
+	if err != nil || pw != password+"2" {
+		t.Errorf("Expected password %s, got %s, %v", password+"2", pw, err)
+	}
+
+	pw, err = op.Get("op://test/"+service+"%"+user+"/password", "")
+	if err != nil || pw != password+"2" {
+		t.Errorf("Expected the reference to resolve to %s, got %s, %v", password+"2", pw, err)
+	}
+
+	data := []byte{0xff, 0x00, 0xfe}
+	err = op.SetBytes(service, user+"2", data)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	got, err := op.GetBytes(service, user+"2")
+	if err != nil || string(got) != string(data) {
+		t.Errorf("Expected data %v, got %v, %v", data, got, err)
+	}
+
+	users, err := op.List(service)
+	if err != nil || strings.Join(users, ",") != user+","+user+"2" {
+		t.Errorf("Expected users %s and %s, got %v, %v", user, user+"2", users, err)
+	}
+
+	// a service starting with a dash isn't taken for a flag
+	err = op.Set("--vault", user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	pw, err = op.Get("--vault", user)
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+	err = op.Delete("--vault", user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = op.Set(service, "a/"+user, password)
+	if err == nil {
+		t.Errorf("Expected users containing a slash to be refused")
+	}
+
+	err = op.Delete(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	err = op.Delete(service, user)
+	assertError(t, err, ErrNotFound)
+
+	ok, err := op.Exists(service, user)
+	if err != nil || ok {
+		t.Errorf("Expected the secret to be deleted, got %t, %v", ok, err)
+	}
+
+	err = op.DeleteAll(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	_, err = op.List(service)
+	assertError(t, err, ErrNotFound)
+}
@@ -0,0 +1,217 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package keyring
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const execPathPass = "pass"
+
+// passProvider stores secrets in the password store of pass, the standard
+// unix password manager, at service/user.
+type passProvider struct{}
+
+// NewPassProvider returns a Keyring storing secrets as entries of the pass
+// password store at service/user. The store is located through
+// $PASSWORD_STORE_DIR like pass does, and pass must be set up with a GPG key.
+//
+// Secrets are stored as given, so Set and SetBytes round-trip with GetBytes.
+// Get removes the trailing newline pass insert appends, so entries added with
+// pass can be read as well. Names are passed to pass after "--", so services
+// starting with a dash aren't taken for options.
+func NewPassProvider() Keyring {
+	return passProvider{}
+}
+
+// Describe returns the provider with the location of the store.
+func (p passProvider) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "pass", Config: map[string]string{"dir": p.dir()}}}
+}
+
+// Persistent reports that the store is kept on disk and survives a reboot.
+func (p passProvider) Persistent() bool {
+	return true
+}
+
+// dir returns the directory of the password store.
+func (p passProvider) dir() string {
+	if dir := os.Getenv("PASSWORD_STORE_DIR"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".password-store")
+}
+
+// entry returns the name of the entry of service and user.
+func (p passProvider) entry(service, user string) (string, error) {
+	name := service + "/" + user
+	return name, checkPassName(name)
+}
+
+// checkPassName refuses names which would escape the store or the service
+// directory, like pass does.
+func checkPassName(name string) error {
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid pass entry name %q", name)
+		}
+	}
+	return nil
+}
+
+// run runs pass with args and stdin, and returns its output. The error
+// includes what pass printed to stderr.
+func (p passProvider) run(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command(execPathPass, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w", msg, err)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// Set stores user and pass in the keyring under the defined service name.
+func (p passProvider) Set(service, user, pass string) error {
+	data := []byte(pass)
+	defer wipe(data)
+
+	return p.SetBytes(service, user, data)
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (p passProvider) SetBytes(service, user string, data []byte) error {
+	name, err := p.entry(service, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.run(data, "insert", "--multiline", "--force", "--", name)
+	return err
+}
+
+// Get gets a secret from the keyring given a service name and a user,
+// without the trailing newline of entries added with pass insert.
+func (p passProvider) Get(service, user string) (string, error) {
+	data, err := p.GetBytes(service, user)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(data)
+
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (p passProvider) GetBytes(service, user string) ([]byte, error) {
+	ok, err := p.Exists(service, user)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return p.run(nil, "show", "--", service+"/"+user)
+}
+
+// Exists reports whether a secret is stored for service and user, by
+// looking for its file in the store.
+func (p passProvider) Exists(service, user string) (bool, error) {
+	name, err := p.entry(service, user)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(filepath.Join(p.dir(), filepath.FromSlash(name)+".gpg"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring.
+func (p passProvider) Delete(service, user string) error {
+	ok, err := p.Exists(service, user)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+
+	_, err = p.run(nil, "rm", "--force", "--", service+"/"+user)
+	return err
+}
+
+// DeleteAll deletes all secrets for a given service by removing its
+// directory.
+func (p passProvider) DeleteAll(service string) error {
+	// if service is empty, do nothing otherwise it might accidentally delete all secrets
+	if service == "" {
+		return ErrNotFound
+	}
+	if err := checkPassName(service); err != nil {
+		return err
+	}
+
+	_, err := os.Stat(filepath.Join(p.dir(), filepath.FromSlash(service)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = p.run(nil, "rm", "--recursive", "--force", "--", service)
+	return err
+}
+
+// List returns the users with a secret stored for a given service.
+func (p passProvider) List(service string) ([]string, error) {
+	if err := checkPassName(service); err != nil {
+		return []string{}, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(p.dir(), filepath.FromSlash(service)))
+	if os.IsNotExist(err) {
+		return []string{}, ErrNotFound
+	}
+	if err != nil {
+		return []string{}, err
+	}
+
+	users := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".gpg") {
+			users = append(users, strings.TrimSuffix(e.Name(), ".gpg"))
+		}
+	}
+
+	if len(users) == 0 {
+		return users, ErrNotFound
+	}
+	return users, nil
+}
+
+func init() {
+	backends["pass"] = NewPassProvider
+}
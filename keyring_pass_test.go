@@ -0,0 +1,128 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package keyring
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakePass stands in for pass, storing entries unencrypted. Like pass, it
+// takes the name after "--" as the last argument and fails on options it
+// doesn't know.
+const fakePass = `#!/bin/sh
+store=$PASSWORD_STORE_DIR
+for name; do :; done
+for arg; do
+	case $arg in
+	--) break ;;
+	--multiline|--force|--recursive) ;;
+	-*) echo "unknown option $arg" >&2; exit 1 ;;
+	esac
+done
+case $1 in
+insert) mkdir -p "$(dirname "$store/$name")" && cat > "$store/$name.gpg" ;;
+show) cat "$store/$name.gpg" ;;
+rm) if [ "$2" = --recursive ]; then rm -r "$store/$name"; else rm "$store/$name.gpg"; fi ;;
+esac
+`
+
+// TestPassProvider tests storing secrets as entries of the password store.
+func TestPassProvider(t *testing.T) {
+	bin := t.TempDir()
+	err := os.WriteFile(filepath.Join(bin, "pass"), []byte(fakePass), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	store := t.TempDir()
+	t.Setenv("PASSWORD_STORE_DIR", store)
+
+	pp := NewPassProvider()
+
+	_, err = pp.Get(service, user)
+	assertError(t, err, ErrNotFound)
+
+	err = pp.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	// stored as given, so it round-trips with GetBytes
+	data, err := pp.GetBytes(service, user)
+	if err != nil || string(data) != password {
+		t.Errorf("Expected entry %q, got %q, %v", password, data, err)
+	}
+
+	// entries added with pass insert end with a newline
+	err = os.WriteFile(filepath.Join(store, service, user+"3.gpg"), []byte(password+"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := pp.Get(service, user+"3")
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s without the newline, got %q, %v", password, pw, err)
+	}
+	err = pp.Delete(service, user+"3")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	// a service starting with a dash isn't taken for an option
+	err = pp.Set("-c", user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	pw, err = pp.Get("-c", user)
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+	err = pp.DeleteAll("-c")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	pw, err = pp.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	err = pp.Set(service, user+"2", password+"2")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	users, err := pp.List(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(users) != 2 || users[0] != user || users[1] != user+"2" {
+		t.Errorf("Expected users %s and %s, got %v", user, user+"2", users)
+	}
+
+	err = pp.Set(service, "../"+user, password)
+	if err == nil {
+		t.Errorf("Expected names escaping the service to be refused")
+	}
+
+	err = pp.Delete(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = pp.Delete(service, user)
+	assertError(t, err, ErrNotFound)
+
+	err = pp.DeleteAll(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	_, err = pp.List(service)
+	assertError(t, err, ErrNotFound)
+}
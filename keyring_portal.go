@@ -0,0 +1,205 @@
+//go:build (dragonfly && cgo) || (freebsd && cgo) || linux || netbsd || openbsd
+
+package keyring
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	portalName            = "org.freedesktop.portal.Desktop"
+	portalPath            = "/org/freedesktop/portal/desktop"
+	portalSecretInterface = "org.freedesktop.portal.Secret"
+	portalRequestBasePath = "/org/freedesktop/portal/desktop/request/"
+	portalRequestResponse = "org.freedesktop.portal.Request.Response"
+
+	// flatpakInfoPath only exists inside a Flatpak sandbox.
+	flatpakInfoPath = "/.flatpak-info"
+)
+
+// portalTimeout limits how long retrieving the master secret from the portal
+// may take, replaced in tests.
+var portalTimeout = 30 * time.Second
+
+// portalSecret retrieves the per-application master secret from the XDG
+// Secret portal and derives the keyring file encryption key from it.
+type portalSecret struct {
+	conn func() (*dbus.Conn, error)
+	mu   sync.Mutex
+	key  []byte
+}
+
+// NewPortalProvider returns a Keyring for applications running in a Flatpak
+// or Snap sandbox, where the Secret Service isn't reachable directly. Secrets
+// are stored in a file in the application's data directory, encrypted with a
+// key derived from the master secret the XDG Secret portal hands out to the
+// application.
+//
+// It's selected on first use in a sandbox, or if $GO_KEYRING_PROVIDER is set
+// to "portal". Secrets a sandboxed application stored in the Secret Service
+// before aren't found by it; such applications can keep the Secret Service by
+// setting $GO_KEYRING_PROVIDER to "secret-service", or move the secrets over
+// with Migrate.
+func NewPortalProvider() Keyring {
+	return newPortalProvider(dbus.SessionBus, filepath.Join(dataHome(), "go-keyring", "keyring.json"))
+}
+
+func newPortalProvider(conn func() (*dbus.Conn, error), path string) *fileProvider {
+	secret := &portalSecret{conn: conn}
+	return &fileProvider{path: path, key: secret.Key}
+}
+
+// dataHome returns $XDG_DATA_HOME, which Flatpak points to the application's
+// private data directory.
+func dataHome() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "share")
+}
+
+// inSandbox reports whether the process runs in a Flatpak or a strictly
+// confined Snap sandbox.
+func inSandbox() bool {
+	if _, err := os.Stat(flatpakInfoPath); err == nil {
+		return true
+	}
+	return os.Getenv("SNAP_NAME") != "" && os.Getenv("SNAP_CONFINEMENT") == "strict"
+}
+
+// Key returns the file encryption key, retrieving the master secret from the
+// portal on first use.
+func (p *portalSecret) Key() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.key != nil {
+		return p.key, nil
+	}
+
+	secret, err := p.retrieve()
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("go-keyring"))
+	p.key = mac.Sum(nil)
+
+	return p.key, nil
+}
+
+// retrieve calls RetrieveSecret on the portal, which writes the master secret
+// to the passed file descriptor and signals completion on a request object.
+func (p *portalSecret) retrieve() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), portalTimeout)
+	defer cancel()
+
+	conn, err := p.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	token := make([]byte, 8)
+	_, err = io.ReadFull(rand.Reader, token)
+	if err != nil {
+		return nil, err
+	}
+	handleToken := "gokeyring" + hex.EncodeToString(token)
+
+	// Subscribe before the call, as the response may be signaled before it
+	// returns. Older portals don't derive the request path from the handle
+	// token, so responses are matched against the returned handle.
+	options := []dbus.MatchOption{
+		dbus.WithMatchSender(portalName),
+		dbus.WithMatchInterface("org.freedesktop.portal.Request"),
+		dbus.WithMatchMember("Response"),
+	}
+	err = conn.AddMatchSignal(options...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.RemoveMatchSignal(options...)
+	}()
+
+	responses := make(chan *dbus.Signal, 1)
+	conn.Signal(responses)
+	defer conn.RemoveSignal(responses)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var handle dbus.ObjectPath
+	err = conn.Object(portalName, portalPath).CallWithContext(ctx, portalSecretInterface+".RetrieveSecret", 0,
+		dbus.UnixFD(w.Fd()),
+		map[string]dbus.Variant{"handle_token": dbus.MakeVariant(handleToken)}).Store(&handle)
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	err = r.SetReadDeadline(deadline)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("secret portal: reading the secret: %w", err)
+	}
+
+	err = awaitResponse(ctx, responses, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret portal returned an empty secret")
+	}
+
+	return secret, nil
+}
+
+// awaitResponse waits for the Response signal of request until ctx is done
+// and returns an error unless it reports success.
+func awaitResponse(ctx context.Context, responses <-chan *dbus.Signal, request dbus.ObjectPath) error {
+	for {
+		select {
+		case signal, ok := <-responses:
+			if !ok {
+				return errors.New("secret portal: connection closed before the response")
+			}
+			if signal.Path != request || signal.Name != portalRequestResponse {
+				continue
+			}
+			if len(signal.Body) == 0 {
+				return errors.New("secret portal: response without status")
+			}
+			response, ok := signal.Body[0].(uint32)
+			if !ok || response != 0 {
+				return fmt.Errorf("secret portal request failed with response %v", signal.Body[0])
+			}
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("secret portal didn't respond within %s", portalTimeout)
+		}
+	}
+}
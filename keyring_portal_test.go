@@ -0,0 +1,217 @@
+//go:build (dragonfly && cgo) || (freebsd && cgo) || linux || netbsd || openbsd
+
+package keyring
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+// fakePortal implements the RetrieveSecret method of the Secret portal. It
+// responds with body, or success if nil, unless silent is set. Like older
+// portals, it ignores the handle token if handle is set and responds on that
+// request instead.
+type fakePortal struct {
+	conn   *dbus.Conn
+	secret []byte
+	body   []interface{}
+	silent bool
+	handle dbus.ObjectPath
+}
+
+func (p fakePortal) RetrieveSecret(sender dbus.Sender, fd dbus.UnixFD, options map[string]dbus.Variant) (dbus.ObjectPath, *dbus.Error) {
+	f := os.NewFile(uintptr(fd), "secret")
+	_, _ = f.Write(p.secret)
+	f.Close()
+
+	token := options["handle_token"].Value().(string)
+	path := dbus.ObjectPath(portalRequestBasePath +
+		strings.ReplaceAll(strings.TrimPrefix(string(sender), ":"), ".", "_") + "/" + token)
+	if p.handle != "" {
+		path = p.handle
+	}
+	if p.silent {
+		return path, nil
+	}
+	body := p.body
+	if body == nil {
+		body = []interface{}{uint32(0), map[string]dbus.Variant{}}
+	}
+	err := p.conn.Emit(path, portalRequestResponse, body...)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+
+	return path, nil
+}
+
+// startBus starts a private dbus-daemon and returns a function connecting
+// to it.
+func startBus(t *testing.T) func() *dbus.Conn {
+	t.Helper()
+
+	path, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+
+	cmd := exec.Command(path, "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return func() *dbus.Conn {
+		conn, err := dbus.Connect(strings.TrimSpace(address))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn
+	}
+}
+
+// startPortal starts a private dbus-daemon serving a fake Secret portal and
+// returns a client connection to it.
+func startPortal(t *testing.T, secret []byte) *dbus.Conn {
+	t.Helper()
+	return startFakePortal(t, fakePortal{secret: secret})
+}
+
+// startFakePortal starts a private dbus-daemon serving portal and returns a
+// client connection to it.
+func startFakePortal(t *testing.T, portal fakePortal) *dbus.Conn {
+	t.Helper()
+
+	connect := startBus(t)
+	server := connect()
+	portal.conn = server
+	err := server.Export(portal, portalPath, portalSecretInterface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := server.RequestName(portalName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", portalName, err)
+	}
+
+	return connect()
+}
+
+// TestPortalProvider tests storing secrets encrypted with the portal's
+// master secret.
+func TestPortalProvider(t *testing.T) {
+	client := startPortal(t, []byte("master secret"))
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	conn := func() (*dbus.Conn, error) { return client, nil }
+
+	pp := newPortalProvider(conn, path)
+	err := pp.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	pw, err := pp.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if password != pw {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(password)) {
+		t.Errorf("Expected password to be encrypted in the keyring file")
+	}
+
+	// a fresh provider retrieves the same master secret
+	pw, err = newPortalProvider(conn, path).Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if password != pw {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	_, err = pp.Get(service, user+"fake")
+	assertError(t, err, ErrNotFound)
+
+	err = pp.Delete(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	_, err = pp.Get(service, user)
+	assertError(t, err, ErrNotFound)
+}
+
+// TestPortalResponse tests that failed, malformed and missing responses of
+// the portal are reported instead of waiting forever.
+func TestPortalResponse(t *testing.T) {
+	old := portalTimeout
+	defer func() { portalTimeout = old }()
+	portalTimeout = 200 * time.Millisecond
+
+	for _, tc := range []struct {
+		name   string
+		portal fakePortal
+		err    string
+	}{
+		{"denied", fakePortal{body: []interface{}{uint32(1), map[string]dbus.Variant{}}}, "failed with response 1"},
+		{"wrong type", fakePortal{body: []interface{}{"ok"}}, "failed with response ok"},
+		{"silent", fakePortal{silent: true}, "didn't respond"},
+	} {
+		tc.portal.secret = []byte("master secret")
+		client := startFakePortal(t, tc.portal)
+		conn := func() (*dbus.Conn, error) { return client, nil }
+
+		err := newPortalProvider(conn, filepath.Join(t.TempDir(), "keyring.json")).Set(service, user, password)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+// TestPortalHandle tests that the response is awaited on the request handle
+// returned by the portal, which older portals don't derive from the handle
+// token.
+func TestPortalHandle(t *testing.T) {
+	old := portalTimeout
+	defer func() { portalTimeout = old }()
+	portalTimeout = 200 * time.Millisecond
+
+	client := startFakePortal(t, fakePortal{
+		secret: []byte("master secret"),
+		handle: portalRequestBasePath + "legacy/1",
+	})
+	conn := func() (*dbus.Conn, error) { return client, nil }
+
+	pp := newPortalProvider(conn, filepath.Join(t.TempDir(), "keyring.json"))
+	err := pp.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+}
@@ -0,0 +1,81 @@
+package keyring
+
+// readOnlyProvider passes reads through to an underlying keyring and refuses
+// writes.
+type readOnlyProvider struct {
+	keyring Keyring
+}
+
+// NewReadOnlyProvider returns a Keyring reading secrets from k, but failing
+// every call which would store or delete a secret with ErrUnsupported, e.g.
+// as a guardrail for viewers installed with SetProvider.
+func NewReadOnlyProvider(k Keyring) Keyring {
+	return readOnlyProvider{keyring: k}
+}
+
+// Describe returns the provider chain.
+func (r readOnlyProvider) Describe() []ProviderInfo {
+	return append([]ProviderInfo{{Name: "read-only"}}, describe(r.keyring)...)
+}
+
+// Persistent reports whether the underlying keyring survives a reboot.
+func (r readOnlyProvider) Persistent() bool {
+	return persistent(r.keyring)
+}
+
+// Set is not supported as the provider is read-only.
+func (r readOnlyProvider) Set(service, user, pass string) error {
+	return ErrUnsupported
+}
+
+// Get gets a secret from the keyring given a service name and a user.
+func (r readOnlyProvider) Get(service, user string) (string, error) {
+	return r.keyring.Get(service, user)
+}
+
+// SetBytes is not supported as the provider is read-only.
+func (r readOnlyProvider) SetBytes(service, user string, data []byte) error {
+	return ErrUnsupported
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (r readOnlyProvider) GetBytes(service, user string) ([]byte, error) {
+	return r.keyring.GetBytes(service, user)
+}
+
+// Exists reports whether a secret is stored for service and user.
+func (r readOnlyProvider) Exists(service, user string) (bool, error) {
+	return r.keyring.Exists(service, user)
+}
+
+// Delete is not supported as the provider is read-only.
+func (r readOnlyProvider) Delete(service, user string) error {
+	return ErrUnsupported
+}
+
+// DeleteAll is not supported as the provider is read-only.
+func (r readOnlyProvider) DeleteAll(service string) error {
+	return ErrUnsupported
+}
+
+// List returns the users with a secret stored for a given service.
+func (r readOnlyProvider) List(service string) ([]string, error) {
+	return r.keyring.List(service)
+}
+
+// inventory returns the metadata of all secrets of the underlying keyring,
+// if it can enumerate them.
+func (r readOnlyProvider) inventory() ([]InventoryItem, error) {
+	p, ok := r.keyring.(inventoryKeyring)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return p.inventory()
+}
+
+// capabilities returns the optional features of the underlying keyring which
+// the provider passes through.
+func (r readOnlyProvider) capabilities() Capability {
+	return capabilities(r.keyring) & CapabilityInventory
+}
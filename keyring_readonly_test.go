@@ -0,0 +1,34 @@
+package keyring
+
+import "testing"
+
+// TestReadOnlyProvider tests reading through the read-only provider while
+// writes are refused.
+func TestReadOnlyProvider(t *testing.T) {
+	mp := &mockProvider{}
+	err := mp.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	rp := NewReadOnlyProvider(mp)
+
+	pw, err := rp.Get(service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+
+	err = rp.Set(service, user, password+"2")
+	assertError(t, err, ErrUnsupported)
+
+	err = rp.Delete(service, user)
+	assertError(t, err, ErrUnsupported)
+
+	err = rp.DeleteAll(service)
+	assertError(t, err, ErrUnsupported)
+
+	pw, err = mp.Get(service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected the secret to be unchanged, got %s, %v", pw, err)
+	}
+}
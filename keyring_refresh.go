@@ -0,0 +1,153 @@
+package keyring
+
+import (
+	"sync"
+	"time"
+)
+
+// refresher renews a secret before it expires.
+type refresher struct {
+	fn func(old string) (string, time.Duration, error)
+	// expires holds the expiry of each refreshed secret by the service it's
+	// stored under, with the prefix of its instance, and its user. A secret
+	// is missing until its first refresh.
+	expires map[string]time.Time
+}
+
+var (
+	refreshersMu sync.Mutex
+	refreshers   = map[string]*refresher{}
+	// refreshLocks makes sure only one Get refreshes a secret at a time.
+	refreshLocks keyedMutex
+	// refreshBefore is how long before its expiry a secret is refreshed.
+	refreshBefore = time.Minute
+)
+
+// expiresAttribute is the attribute the expiry of a refreshed secret is
+// stored in, where the provider supports attributes.
+const expiresAttribute = "expires"
+
+// SetRefresher registers fn to renew the secret of service and user. When
+// Get reads the secret within a minute of its expiry, fn is called with the
+// old secret, its result is stored with Set and returned instead. Concurrent
+// Gets trigger a single refresh. If fn or Set fails before the secret has
+// expired, Get returns the old secret and the next Get tries again.
+//
+// The refresher applies to service as passed to Get, by the package level
+// functions and every Keyring returned by New, but each namespace keeps its
+// own secret and expiry.
+//
+// The expiry is computed from the ttl returned by fn. Where the provider
+// supports attributes, i.e. the Secret Service and the mock, it's stored in
+// the "expires" attribute of the secret, so other processes and later runs
+// know it. Other providers, such as the macOS keychain, the Windows
+// Credential Manager and the file provider, can't store it, so it's only
+// tracked in memory: each process refreshes the secret on its first Get, e.g.
+// a CLI on every run. Passing a nil fn removes the refresher.
+func SetRefresher(service, user string, fn func(old string) (new string, ttl time.Duration, err error)) {
+	refreshersMu.Lock()
+	defer refreshersMu.Unlock()
+
+	key := service + "\x00" + user
+	if fn == nil {
+		delete(refreshers, key)
+		return
+	}
+	refreshers[key] = &refresher{fn: fn, expires: map[string]time.Time{}}
+}
+
+// refresh returns secret, or its refreshed replacement if a refresher is
+// registered for service and user and the secret is about to expire. The
+// replacement is stored through i. The expiry is tracked per stored secret,
+// so instances with different prefixes refresh their secrets independently.
+// If the refresh fails while the secret hasn't expired yet, it's returned and
+// the next Get tries again.
+func (i instance) refresh(service, user, secret string) (string, error) {
+	refreshersMu.Lock()
+	r := refreshers[service+"\x00"+user]
+	refreshersMu.Unlock()
+	if r == nil {
+		return secret, nil
+	}
+
+	key := i.service(service) + "\x00" + user
+	expiry := func() time.Time {
+		refreshersMu.Lock()
+		defer refreshersMu.Unlock()
+		return r.expires[key]
+	}
+	expiring := func(expires time.Time) bool {
+		return expires.IsZero() || !clock().Add(refreshBefore).Before(expires)
+	}
+
+	// the expiry of a secret refreshed by another process or an earlier run
+	if expiry().IsZero() {
+		expires := i.storedExpiry(service, user)
+		refreshersMu.Lock()
+		if _, ok := r.expires[key]; !ok && !expires.IsZero() {
+			r.expires[key] = expires
+		}
+		refreshersMu.Unlock()
+	}
+
+	if !expiring(expiry()) {
+		return secret, nil
+	}
+
+	unlock := refreshLocks.lock(key)
+	defer unlock()
+
+	// another Get refreshed the secret while we were waiting
+	expires := expiry()
+	if !expiring(expires) {
+		start := begin()
+		secret, err := i.keyring.Get(i.service(service), user)
+		if err = i.finish("get", service, user, start, err); err != nil {
+			return "", err
+		}
+		return secret, nil
+	}
+
+	renewed, ttl, err := r.fn(secret)
+	if err == nil {
+		err = i.Set(service, user, renewed)
+	}
+	if err != nil {
+		if !expires.IsZero() && clock().Before(expires) {
+			return secret, nil
+		}
+		return "", err
+	}
+
+	expires = clock().Add(ttl)
+	refreshersMu.Lock()
+	r.expires[key] = expires
+	refreshersMu.Unlock()
+
+	// without the stored expiry it's still tracked in memory
+	if p, ok := i.keyring.(attributeKeyring); ok {
+		_ = p.UpdateAttributes(i.service(service), user, map[string]string{
+			expiresAttribute: expires.UTC().Format(time.RFC3339),
+		})
+	}
+	return renewed, nil
+}
+
+// storedExpiry returns the expiry stored with the secret of service and user
+// by an earlier refresh, or the zero time if there's none.
+func (i instance) storedExpiry(service, user string) time.Time {
+	p, ok := i.keyring.(attributeKeyring)
+	if !ok {
+		return time.Time{}
+	}
+
+	attrs, err := p.GetAttributes(i.service(service), user)
+	if err != nil {
+		return time.Time{}
+	}
+	expires, err := time.Parse(time.RFC3339, attrs[expiresAttribute])
+	if err != nil {
+		return time.Time{}
+	}
+	return expires
+}
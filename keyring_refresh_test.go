@@ -0,0 +1,194 @@
+package keyring
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRefresher tests refreshing a secret which is about to expire.
+func TestRefresher(t *testing.T) {
+	defer func(p Keyring) { provider = p }(provider)
+	defer func() { clock = time.Now }()
+	provider = &fileProvider{path: t.TempDir() + "/keyring.json", key: func() ([]byte, error) {
+		return make([]byte, 32), nil
+	}}
+
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return current }
+
+	var refreshes int32
+	SetRefresher(service, user, func(old string) (string, time.Duration, error) {
+		n := atomic.AddInt32(&refreshes, 1)
+		return old + "+", time.Hour * time.Duration(n), nil
+	})
+	defer SetRefresher(service, user, nil)
+
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	// the expiry isn't known before the first refresh, concurrent Gets
+	// refresh once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pw, err := Get(service, user)
+			if err != nil {
+				t.Errorf("Should not fail, got: %s", err)
+			}
+			if pw != password+"+" {
+				t.Errorf("Expected password %s, got %s", password+"+", pw)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if refreshes != 1 {
+		t.Errorf("Expected a single refresh, got %d", refreshes)
+	}
+
+	// far from expiry the stored secret is returned
+	current = current.Add(30 * time.Minute)
+	pw, err := Get(service, user)
+	if err != nil || pw != password+"+" || refreshes != 1 {
+		t.Errorf("Expected no refresh, got %s, %v after %d refreshes", pw, err, refreshes)
+	}
+
+	// close to expiry the secret is refreshed and stored
+	current = current.Add(29*time.Minute + 30*time.Second)
+	pw, err = Get(service, user)
+	if err != nil || pw != password+"++" || refreshes != 2 {
+		t.Errorf("Expected a refresh, got %s, %v after %d refreshes", pw, err, refreshes)
+	}
+
+	pw, err = provider.Get(service, user)
+	if err != nil || pw != password+"++" {
+		t.Errorf("Expected the refreshed secret to be stored, got %s, %v", pw, err)
+	}
+}
+
+// TestRefresherStoredExpiry tests that the expiry is stored with the secret,
+// so a new process doesn't refresh it again.
+func TestRefresherStoredExpiry(t *testing.T) {
+	defer func(p Keyring) { provider = p }(provider)
+	defer func() { clock = time.Now }()
+	provider = &mockProvider{}
+
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return current }
+
+	refreshes := 0
+	fn := func(old string) (string, time.Duration, error) {
+		refreshes++
+		return old + "+", time.Hour, nil
+	}
+	SetRefresher(service, user, fn)
+	defer SetRefresher(service, user, nil)
+
+	err := Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	_, err = Get(service, user)
+	if err != nil || refreshes != 1 {
+		t.Fatalf("Expected a refresh, got %v after %d refreshes", err, refreshes)
+	}
+
+	attrs, err := GetAttributes(service, user)
+	if err != nil || attrs[expiresAttribute] != "2024-01-01T01:00:00Z" {
+		t.Errorf("Expected the expiry to be stored, got %v, %v", attrs, err)
+	}
+
+	// registering the refresher again forgets the expiry in memory, like a
+	// new process
+	SetRefresher(service, user, fn)
+	current = current.Add(30 * time.Minute)
+	pw, err := Get(service, user)
+	if err != nil || pw != password+"+" || refreshes != 1 {
+		t.Errorf("Expected no refresh, got %s, %v after %d refreshes", pw, err, refreshes)
+	}
+}
+
+// TestRefresherNamespaces tests that instances with different namespaces
+// sharing a refresher track the expiry of their own secrets.
+func TestRefresherNamespaces(t *testing.T) {
+	defer func() { clock = time.Now }()
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return current }
+
+	refreshes := 0
+	SetRefresher(service, user, func(old string) (string, time.Duration, error) {
+		refreshes++
+		return old + "+", time.Hour, nil
+	})
+	defer SetRefresher(service, user, nil)
+
+	// the file provider can't store the expiry, so it's only known in memory
+	k := &fileProvider{path: t.TempDir() + "/keyring.json", key: func() ([]byte, error) {
+		return make([]byte, 32), nil
+	}}
+	a := instance{keyring: k, prefix: "a/"}
+	b := instance{keyring: k, prefix: "b/"}
+
+	for _, in := range []instance{a, b} {
+		if err := in.Set(service, user, password); err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+	}
+
+	pw, err := a.Get(service, user)
+	if err != nil || pw != password+"+" || refreshes != 1 {
+		t.Errorf("Expected a refresh, got %s, %v after %d refreshes", pw, err, refreshes)
+	}
+
+	// the refresh of a doesn't tell anything about the secret of b
+	pw, err = b.Get(service, user)
+	if err != nil || pw != password+"+" || refreshes != 2 {
+		t.Errorf("Expected a refresh, got %s, %v after %d refreshes", pw, err, refreshes)
+	}
+}
+
+// TestRefresherFailure tests that a failing refresh returns the old secret
+// until it has expired.
+func TestRefresherFailure(t *testing.T) {
+	defer func(p Keyring) { provider = p }(provider)
+	defer func() { clock = time.Now }()
+	provider = &mockProvider{}
+
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return current }
+
+	var failure error
+	SetRefresher(service, user, func(old string) (string, time.Duration, error) {
+		return old + "+", time.Hour, failure
+	})
+	defer SetRefresher(service, user, nil)
+
+	err := Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	_, err = Get(service, user)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	failure = errors.New("token endpoint down")
+	current = current.Add(59*time.Minute + 30*time.Second)
+	pw, err := Get(service, user)
+	if err != nil || pw != password+"+" {
+		t.Errorf("Expected the old secret before its expiry, got %s, %v", pw, err)
+	}
+
+	current = current.Add(time.Minute)
+	_, err = Get(service, user)
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the refresh to fail after the expiry, got %v", err)
+	}
+}
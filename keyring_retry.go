@@ -0,0 +1,448 @@
+package keyring
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// retryProvider retries the calls of an underlying keyring which fail with
+// a transient error.
+type retryProvider struct {
+	keyring  Keyring
+	attempts int
+	backoff  time.Duration
+	ctx      context.Context
+}
+
+// RetryOption configures the provider returned by NewRetryProvider.
+type RetryOption func(*retryProvider)
+
+// WithRetryContext stops retrying once ctx is done, e.g. when the
+// application shuts down. The call then returns the error of its last
+// attempt.
+func WithRetryContext(ctx context.Context) RetryOption {
+	return func(r *retryProvider) {
+		r.ctx = ctx
+	}
+}
+
+// sleep waits d between attempts or until ctx is done, replaced in tests.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// platformTransient reports whether err is a transient error of the
+// platform's keyring, replaced on init by the platforms which have them.
+var platformTransient = func(err error) bool { return false }
+
+// NewRetryProvider returns a Keyring which retries a failing call of k up to
+// attempts times in total, waiting backoff before the first retry and twice
+// as long before each following one. This helps e.g. applications started
+// at login, when the Secret Service may not be up yet.
+//
+// Only errors telling the keyring can't be reached yet are retried: a missing
+// session bus, a Secret Service which isn't running or doesn't reply, and
+// network errors. Other errors, such as ErrNotFound or a denied access, are
+// returned right away since retrying can't change their outcome. The optional
+// features of k, such as attributes or labels, are passed through and retried
+// as well.
+func NewRetryProvider(k Keyring, attempts int, backoff time.Duration, opts ...RetryOption) Keyring {
+	if attempts < 1 {
+		attempts = 1
+	}
+	r := retryProvider{keyring: k, attempts: attempts, backoff: backoff, ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return r
+}
+
+// transient reports whether err may go away by retrying, as the keyring
+// couldn't be reached.
+func transient(err error) bool {
+	if errors.Is(err, ErrNoSessionBus) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return platformTransient(err)
+}
+
+// Describe returns the provider chain with the retry settings.
+func (r retryProvider) Describe() []ProviderInfo {
+	info := ProviderInfo{Name: "retry", Config: map[string]string{
+		"attempts": strconv.Itoa(r.attempts),
+		"backoff":  r.backoff.String(),
+	}}
+	return append([]ProviderInfo{info}, describe(r.keyring)...)
+}
+
+// Persistent reports whether the underlying keyring survives a reboot.
+func (r retryProvider) Persistent() bool {
+	return persistent(r.keyring)
+}
+
+// retry calls fn until it succeeds, fails with an error which isn't
+// transient, the attempts are used up or the context is done, and returns
+// its last error.
+func (r retryProvider) retry(fn func() error) error {
+	backoff := r.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.attempts || !transient(err) {
+			return err
+		}
+		if sleep(r.ctx, backoff) != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// Set stores user and pass in the keyring under the defined service name.
+func (r retryProvider) Set(service, user, pass string) error {
+	return r.retry(func() error {
+		return r.keyring.Set(service, user, pass)
+	})
+}
+
+// Get gets a secret from the keyring given a service name and a user.
+func (r retryProvider) Get(service, user string) (string, error) {
+	var secret string
+	err := r.retry(func() (err error) {
+		secret, err = r.keyring.Get(service, user)
+		return err
+	})
+	return secret, err
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (r retryProvider) SetBytes(service, user string, data []byte) error {
+	return r.retry(func() error {
+		return r.keyring.SetBytes(service, user, data)
+	})
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (r retryProvider) GetBytes(service, user string) ([]byte, error) {
+	var data []byte
+	err := r.retry(func() (err error) {
+		data, err = r.keyring.GetBytes(service, user)
+		return err
+	})
+	return data, err
+}
+
+// Exists reports whether a secret is stored for service and user.
+func (r retryProvider) Exists(service, user string) (bool, error) {
+	var ok bool
+	err := r.retry(func() (err error) {
+		ok, err = r.keyring.Exists(service, user)
+		return err
+	})
+	return ok, err
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring.
+func (r retryProvider) Delete(service, user string) error {
+	return r.retry(func() error {
+		return r.keyring.Delete(service, user)
+	})
+}
+
+// DeleteAll deletes all secrets for a given service
+func (r retryProvider) DeleteAll(service string) error {
+	return r.retry(func() error {
+		return r.keyring.DeleteAll(service)
+	})
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted, or 0 if the underlying keyring can't count them.
+func (r retryProvider) deleteAllCount(service string) (int, error) {
+	var n int
+	err := r.retry(func() (err error) {
+		n, err = deleteAllCount(r.keyring, service)
+		return err
+	})
+	return n, err
+}
+
+// List returns the users with a secret stored for a given service.
+func (r retryProvider) List(service string) ([]string, error) {
+	var users []string
+	err := r.retry(func() (err error) {
+		users, err = r.keyring.List(service)
+		return err
+	})
+	return users, err
+}
+
+// capabilities returns the optional features of the underlying keyring.
+func (r retryProvider) capabilities() Capability {
+	return capabilities(r.keyring)
+}
+
+// probe checks that the backend of the underlying keyring can be reached,
+// retrying like the other calls.
+func (r retryProvider) probe() error {
+	return r.retry(func() error {
+		return probe(r.keyring)
+	})
+}
+
+// closeSession closes the session of the underlying keyring, if it keeps
+// one open.
+func (r retryProvider) closeSession() error {
+	if c, ok := r.keyring.(sessionCloser); ok {
+		return c.closeSession()
+	}
+	return nil
+}
+
+// flush forgets the secrets remembered by the underlying keyring, if any.
+func (r retryProvider) flush() {
+	if c, ok := r.keyring.(cacheFlusher); ok {
+		c.flush()
+	}
+}
+
+// SetIfAbsent stores pass unless a secret is already stored for service and
+// user.
+func (r retryProvider) SetIfAbsent(service, user, pass string) error {
+	return r.retry(func() error {
+		return setIfAbsent(r.keyring, service, user, pass)
+	})
+}
+
+// SetWithLabel stores pass shown under label.
+func (r retryProvider) SetWithLabel(service, user, pass, label string) error {
+	p, ok := r.keyring.(labelKeyring)
+	if !ok {
+		return ErrUnsupported
+	}
+	return r.retry(func() error {
+		return p.SetWithLabel(service, user, pass, label)
+	})
+}
+
+// Rename moves the secret of oldUser to newUser within service.
+func (r retryProvider) Rename(service, oldUser, newUser string) error {
+	return r.retry(func() error {
+		if p, ok := r.keyring.(renamer); ok {
+			return p.Rename(service, oldUser, newUser)
+		}
+		return rename(r.keyring, service, oldUser, newUser)
+	})
+}
+
+// Copy stores the secret of srcUser in srcService for dstUser in dstService.
+func (r retryProvider) Copy(srcService, srcUser, dstService, dstUser string, overwrite bool) error {
+	return r.retry(func() error {
+		if p, ok := r.keyring.(copier); ok {
+			return p.Copy(srcService, srcUser, dstService, dstUser, overwrite)
+		}
+		return copySecret(r.keyring, srcService, srcUser, dstService, dstUser, overwrite)
+	})
+}
+
+// SetWithAttributes stores pass under service, tagged with attrs.
+func (r retryProvider) SetWithAttributes(service string, attrs map[string]string, pass string) error {
+	p, ok := r.keyring.(attributeKeyring)
+	if !ok {
+		return ErrUnsupported
+	}
+	return r.retry(func() error {
+		return p.SetWithAttributes(service, attrs, pass)
+	})
+}
+
+// GetWithAttributes gets the secret of service matching attrs.
+func (r retryProvider) GetWithAttributes(service string, attrs map[string]string) (string, error) {
+	p, ok := r.keyring.(attributeKeyring)
+	if !ok {
+		return "", ErrUnsupported
+	}
+	var secret string
+	err := r.retry(func() (err error) {
+		secret, err = p.GetWithAttributes(service, attrs)
+		return err
+	})
+	return secret, err
+}
+
+// ExistsWithAttributes reports whether a secret of service matches attrs.
+func (r retryProvider) ExistsWithAttributes(service string, attrs map[string]string) (bool, error) {
+	p, ok := r.keyring.(attributeKeyring)
+	if !ok {
+		return false, ErrUnsupported
+	}
+	var exists bool
+	err := r.retry(func() (err error) {
+		exists, err = p.ExistsWithAttributes(service, attrs)
+		return err
+	})
+	return exists, err
+}
+
+// DeleteWithAttributes deletes the secret of service matching attrs.
+func (r retryProvider) DeleteWithAttributes(service string, attrs map[string]string) error {
+	p, ok := r.keyring.(attributeKeyring)
+	if !ok {
+		return ErrUnsupported
+	}
+	return r.retry(func() error {
+		return p.DeleteWithAttributes(service, attrs)
+	})
+}
+
+// Find returns the attributes of all secrets matching attrs.
+func (r retryProvider) Find(attrs map[string]string) ([]map[string]string, error) {
+	p, ok := r.keyring.(attributeKeyring)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	var found []map[string]string
+	err := r.retry(func() (err error) {
+		found, err = p.Find(attrs)
+		return err
+	})
+	return found, err
+}
+
+// GetAttributes returns the attributes of the secret of service and user.
+func (r retryProvider) GetAttributes(service, user string) (map[string]string, error) {
+	p, ok := r.keyring.(attributeKeyring)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	var attrs map[string]string
+	err := r.retry(func() (err error) {
+		attrs, err = p.GetAttributes(service, user)
+		return err
+	})
+	return attrs, err
+}
+
+// UpdateAttributes sets attrs on the secret of service and user.
+func (r retryProvider) UpdateAttributes(service, user string, attrs map[string]string) error {
+	p, ok := r.keyring.(attributeKeyring)
+	if !ok {
+		return ErrUnsupported
+	}
+	return r.retry(func() error {
+		return p.UpdateAttributes(service, user, attrs)
+	})
+}
+
+// GetModified returns when the secret of service and user was last changed.
+func (r retryProvider) GetModified(service, user string) (time.Time, error) {
+	p, ok := r.keyring.(modifiedKeyring)
+	if !ok {
+		return time.Time{}, ErrUnsupported
+	}
+	var modified time.Time
+	err := r.retry(func() (err error) {
+		modified, err = p.GetModified(service, user)
+		return err
+	})
+	return modified, err
+}
+
+// Collections returns the labels of the collections of the underlying
+// keyring.
+func (r retryProvider) Collections() ([]string, error) {
+	p, ok := r.keyring.(collectionKeyring)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	var labels []string
+	err := r.retry(func() (err error) {
+		labels, err = p.Collections()
+		return err
+	})
+	return labels, err
+}
+
+// ActiveCollection returns the label of the collection the underlying
+// keyring stores secrets in.
+func (r retryProvider) ActiveCollection() (string, error) {
+	p, ok := r.keyring.(collectionKeyring)
+	if !ok {
+		return "", ErrUnsupported
+	}
+	var label string
+	err := r.retry(func() (err error) {
+		label, err = p.ActiveCollection()
+		return err
+	})
+	return label, err
+}
+
+// Lock locks the collection of the underlying keyring.
+func (r retryProvider) Lock() error {
+	p, ok := r.keyring.(locker)
+	if !ok {
+		return ErrUnsupported
+	}
+	return r.retry(p.Lock)
+}
+
+// inventory returns the metadata of the secrets of the underlying keyring,
+// if it can enumerate them.
+func (r retryProvider) inventory() ([]InventoryItem, error) {
+	p, ok := r.keyring.(inventoryKeyring)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	var items []InventoryItem
+	err := r.retry(func() (err error) {
+		items, err = p.inventory()
+		return err
+	})
+	return items, err
+}
+
+// duplicates returns the items stored for service and user if there's more
+// than one and the underlying keyring can hold duplicates.
+func (r retryProvider) duplicates(service, user string) ([]InventoryItem, error) {
+	p, ok := r.keyring.(duplicateKeyring)
+	if !ok {
+		return nil, nil
+	}
+	var items []InventoryItem
+	err := r.retry(func() (err error) {
+		items, err = p.duplicates(service, user)
+		return err
+	})
+	return items, err
+}
+
+// deduplicate deletes all but the newest item stored for service and user.
+func (r retryProvider) deduplicate(service, user string) (int, error) {
+	p, ok := r.keyring.(duplicateKeyring)
+	if !ok {
+		return 0, nil
+	}
+	var n int
+	err := r.retry(func() (err error) {
+		n, err = p.deduplicate(service, user)
+		return err
+	})
+	return n, err
+}
@@ -0,0 +1,102 @@
+package keyring
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// flakyProvider fails the first failures calls of Get with err, errFlaky
+// unless set.
+type flakyProvider struct {
+	*mockProvider
+	failures int
+	calls    int
+	err      error
+}
+
+// errFlaky is a transient error, as returned while a socket isn't up yet.
+var errFlaky = &net.OpError{Op: "dial", Net: "unix", Err: os.ErrNotExist}
+
+func (f *flakyProvider) Get(service, user string) (string, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		if f.err != nil {
+			return "", f.err
+		}
+		return "", errFlaky
+	}
+	return f.mockProvider.Get(service, user)
+}
+
+// TestRetryProvider tests that transient errors are retried with a growing
+// backoff, and other errors aren't.
+func TestRetryProvider(t *testing.T) {
+	old := sleep
+	defer func() { sleep = old }()
+
+	var waits []time.Duration
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	fp := &flakyProvider{mockProvider: &mockProvider{}, failures: 2}
+	rp := NewRetryProvider(fp, 3, time.Millisecond)
+
+	err := rp.Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	pw, err := rp.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+	if len(waits) != 2 || waits[0] != time.Millisecond || waits[1] != 2*time.Millisecond {
+		t.Errorf("Expected waits of 1ms and 2ms, got %v", waits)
+	}
+
+	fp.failures, fp.calls = 0, 0
+	_, err = rp.Get(service, user+"fake")
+	assertError(t, err, ErrNotFound)
+	if fp.calls != 1 {
+		t.Errorf("Expected ErrNotFound to not be retried, got %d calls", fp.calls)
+	}
+
+	denied := errors.New("gpg: decryption failed: No secret key")
+	fp.failures, fp.calls, fp.err = 5, 0, denied
+	_, err = rp.Get(service, user)
+	assertError(t, err, denied)
+	if fp.calls != 1 {
+		t.Errorf("Expected a permanent error to not be retried, got %d calls", fp.calls)
+	}
+
+	fp.failures, fp.calls, fp.err = 5, 0, nil
+	_, err = rp.Get(service, user)
+	assertError(t, err, errFlaky)
+	if fp.calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", fp.calls)
+	}
+}
+
+// TestRetryContext tests that retrying stops once the context is done.
+func TestRetryContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fp := &flakyProvider{mockProvider: &mockProvider{}, failures: 5}
+	rp := NewRetryProvider(fp, 5, time.Hour, WithRetryContext(ctx))
+
+	_, err := rp.Get(service, user)
+	assertError(t, err, errFlaky)
+	if fp.calls != 1 {
+		t.Errorf("Expected no retry after the context is done, got %d calls", fp.calls)
+	}
+}
@@ -1,9 +1,15 @@
 package keyring
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -90,6 +96,23 @@ func TestGetSingleLineHex(t *testing.T) {
 	}
 }
 
+// TestGetEmpty tests getting an empty password from the keyring.
+func TestGetEmpty(t *testing.T) {
+	err := Set(service, user, "")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	pw, err := Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	if pw != "" {
+		t.Errorf("Expected an empty password, got %s", pw)
+	}
+}
+
 // TestGet tests getting a password from the keyring.
 func TestGet(t *testing.T) {
 	err := Set(service, user, password)
@@ -181,3 +204,622 @@ func TestDeleteAllEmptyService(t *testing.T) {
 		t.Errorf("Should not have deleted secret from another service")
 	}
 }
+
+// TestGetOrSet tests generating a secret only if none is stored.
+func TestGetOrSet(t *testing.T) {
+	_ = DeleteAll(service)
+	defer DeleteAll(service)
+
+	calls := 0
+	gen := func() (string, error) {
+		calls++
+		return password, nil
+	}
+
+	pw, err := GetOrSet(service, user, gen)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password || calls != 1 {
+		t.Errorf("Expected the generated password %s, got %s after %d calls", password, pw, calls)
+	}
+
+	pw, err = GetOrSet(service, user, gen)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password || calls != 1 {
+		t.Errorf("Expected the stored password %s, got %s after %d calls", password, pw, calls)
+	}
+
+	genErr := errors.New("generation failed")
+	_, err = GetOrSet(service, user+"2", func() (string, error) { return "", genErr })
+	assertError(t, err, genErr)
+}
+
+// TestDeleteAllCount tests counting the secrets deleted for a service.
+func TestDeleteAllCount(t *testing.T) {
+	_ = DeleteAll(service)
+
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = Set(service, user+"2", password+"2")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	n, err := DeleteAllCount(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 deleted secrets, got %d", n)
+	}
+
+	n, err = DeleteAllCount(service)
+	if err != nil {
+		t.Errorf("Should not fail on empty service, got: %s", err)
+	}
+	if n != 0 {
+		t.Errorf("Expected 0 deleted secrets, got %d", n)
+	}
+
+	_, err = DeleteAllCount("")
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+}
+
+// TestWithAttributes tests targeting one of two profiles sharing service and
+// user.
+func TestWithAttributes(t *testing.T) {
+	work := map[string]string{"username": user, "profile": "work"}
+	home := map[string]string{"username": user, "profile": "home"}
+
+	err := SetWithAttributes(service, work, password+"work")
+	if err == ErrUnsupported {
+		t.Skip("attributes not supported by provider")
+	}
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = SetWithAttributes(service, home, password+"home")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer DeleteAll(service)
+
+	pw, err := GetWithAttributes(service, work)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password+"work" {
+		t.Errorf("Expected password %s, got %s", password+"work", pw)
+	}
+
+	_, err = GetWithAttributes(service, map[string]string{"username": user})
+	if err != ErrMultipleMatches {
+		t.Errorf("Expected error ErrMultipleMatches, got %s", err)
+	}
+
+	err = DeleteWithAttributes(service, map[string]string{"username": user})
+	if err != ErrMultipleMatches {
+		t.Errorf("Expected error ErrMultipleMatches, got %s", err)
+	}
+
+	err = DeleteWithAttributes(service, work)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	exists, err := ExistsWithAttributes(service, work)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if exists {
+		t.Errorf("Expected work profile to be deleted")
+	}
+
+	exists, err = ExistsWithAttributes(service, home)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if !exists {
+		t.Errorf("Expected home profile to still exist")
+	}
+
+	// a plain Set replaces the secret of the remaining profile
+	err = Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	pw, err = Get(service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+	exists, err = ExistsWithAttributes(service, home)
+	if err != nil || !exists {
+		t.Errorf("Expected the home profile to be updated in place, got %v, %v", exists, err)
+	}
+	users, err := List(service)
+	if err != nil || len(users) != 1 {
+		t.Errorf("Expected exactly one user, got %v, %v", users, err)
+	}
+}
+
+// TestListWithAttributes tests listing the users of a service tagged with an
+// attribute.
+func TestListWithAttributes(t *testing.T) {
+	err := SetWithAttributes(service, map[string]string{"username": user, "profile": "work"}, password)
+	if err == ErrUnsupported {
+		t.Skip("attributes not supported by provider")
+	}
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer DeleteAll(service)
+
+	err = SetWithAttributes(service, map[string]string{"username": user + "2", "profile": "home"}, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	users, err := ListWithAttributes(service, map[string]string{"profile": "work"})
+	if err != nil || len(users) != 1 || users[0] != user {
+		t.Errorf("Expected user %s, got %v, %v", user, users, err)
+	}
+
+	_, err = ListWithAttributes(service, map[string]string{"profile": "other"})
+	assertError(t, err, ErrNotFound)
+}
+
+// TestSetValidator tests rejecting secrets with a length enforcing validator.
+func TestSetValidator(t *testing.T) {
+	SetValidator(func(service, user, pass string) error {
+		if len(pass) < 8 {
+			return ErrWeakSecret
+		}
+		return nil
+	})
+	defer SetValidator(nil)
+
+	err := Set(service, user, "short")
+	if err != ErrWeakSecret {
+		t.Errorf("Expected error ErrWeakSecret, got %s", err)
+	}
+
+	_, err = Get(service, user)
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+
+	err = Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = Delete(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+}
+
+// TestSetMaxSecretLength tests that secrets over the limit are refused
+// before reaching the keyring.
+func TestSetMaxSecretLength(t *testing.T) {
+	SetMaxSecretLength(len(password))
+	defer SetMaxSecretLength(0)
+
+	err := Set(service, user, password+"!")
+	if !errors.Is(err, ErrSecretTooLong) {
+		t.Errorf("Expected error ErrSecretTooLong, got %s", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), fmt.Sprintf("%d bytes, at most %d", len(password)+1, len(password))) {
+		t.Errorf("Expected the lengths in the error, got %s", err)
+	}
+
+	_, err = Get(service, user)
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+
+	err = Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = Delete(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+}
+
+// TestInventoryNoSecrets tests that the inventory of the keyring holds no secrets.
+func TestInventoryNoSecrets(t *testing.T) {
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer Delete(service, user)
+
+	var buf bytes.Buffer
+	err = Inventory(&buf)
+	if err == ErrUnsupported {
+		t.Skip("inventory not supported by provider")
+	}
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	if !strings.Contains(buf.String(), service) {
+		t.Errorf("Expected inventory to list %s, got %s", service, buf.String())
+	}
+
+	if strings.Contains(buf.String(), password) {
+		t.Errorf("Inventory must not contain secret values, got %s", buf.String())
+	}
+}
+
+// TestList tests listing the users stored for a service.
+func TestList(t *testing.T) {
+	for _, u := range []string{user, user + "2"} {
+		err := Set(service, u, password)
+		if err != nil {
+			t.Errorf("Should not fail, got: %s", err)
+		}
+	}
+	defer DeleteAll(service)
+
+	users, err := List(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	sort.Strings(users)
+	if len(users) != 2 || users[0] != user || users[1] != user+"2" {
+		t.Errorf("Expected users %s and %s, got %v", user, user+"2", users)
+	}
+
+	_, err = List(service + "fake")
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+}
+
+// TestExists tests checking for a secret without reading it.
+func TestExists(t *testing.T) {
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer Delete(service, user)
+
+	ok, err := Exists(service, user)
+	if err != nil || !ok {
+		t.Errorf("Expected secret to exist, got %t, %v", ok, err)
+	}
+
+	ok, err = Exists(service+"fake", user)
+	if err != nil || ok {
+		t.Errorf("Expected secret not to exist, got %t, %v", ok, err)
+	}
+}
+
+// TestSetIfAbsent tests that an existing secret isn't overwritten.
+func TestSetIfAbsent(t *testing.T) {
+	err := SetIfAbsent(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer Delete(service, user)
+
+	err = SetIfAbsent(service, user, password+"2")
+	if err != ErrAlreadyExists {
+		t.Errorf("Expected error ErrAlreadyExists, got %s", err)
+	}
+
+	pw, err := Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+}
+
+// TestSetGetBytes tests storing binary data which isn't valid UTF-8.
+func TestSetGetBytes(t *testing.T) {
+	data := []byte{0x00, 0xff, 0xfe, 0x80, '\n', 0x01}
+
+	err := SetBytes(service, user, data)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer Delete(service, user)
+
+	got, err := GetBytes(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Errorf("Expected data %x, got %x", data, got)
+	}
+}
+
+// TestFind tests finding secrets stored without the service attribute, like
+// those of other libsecret based tools.
+func TestFind(t *testing.T) {
+	attrs := map[string]string{"xdg:schema": "org.example.Password", "username": user}
+
+	err := SetWithAttributes("", attrs, password)
+	if err == ErrUnsupported {
+		t.Skip("attributes not supported by provider")
+	}
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	defer DeleteWithAttributes("", attrs)
+
+	found, err := Find(map[string]string{"xdg:schema": "org.example.Password"})
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if len(found) != 1 || found[0]["username"] != user {
+		t.Fatalf("Expected the attributes of a single secret, got %v", found)
+	}
+	if _, ok := found[0]["service"]; ok {
+		t.Errorf("Expected no service attribute, got %v", found[0])
+	}
+
+	pw, err := GetWithAttributes("", attrs)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	err = DeleteWithAttributes("", nil)
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound without attributes, got %s", err)
+	}
+}
+
+// TestGetAttributes tests reading back the attributes stored with a secret.
+func TestGetAttributes(t *testing.T) {
+	err := SetWithAttributes(service, map[string]string{"username": user + "attrs", "url": "https://example.com"}, password)
+	if err == ErrUnsupported {
+		t.Skip("attributes not supported by provider")
+	}
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer DeleteAll(service)
+
+	attrs, err := GetAttributes(service, user+"attrs")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if attrs["url"] != "https://example.com" || attrs["service"] != service {
+		t.Errorf("Expected the stored attributes, got %v", attrs)
+	}
+
+	_, err = GetAttributes(service, user+"fake")
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+}
+
+// TestUpdateAttributes tests changing the attributes of a secret while
+// keeping the secret and the attributes identifying it.
+func TestUpdateAttributes(t *testing.T) {
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer DeleteAll(service)
+
+	err = UpdateAttributes(service, user, map[string]string{"state": "needs-reauth", "username": user + "2"})
+	if err == ErrUnsupported {
+		t.Skip("attributes not supported by provider")
+	}
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	attrs, err := GetAttributes(service, user)
+	if err != nil || attrs["state"] != "needs-reauth" || attrs["username"] != user || attrs["service"] != service {
+		t.Errorf("Expected the updated attributes, got %v, %v", attrs, err)
+	}
+
+	pw, err := Get(service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected password %s, got %s, %v", password, pw, err)
+	}
+
+	// Set replaces the secret of the item, keeping its attributes
+	err = Set(service, user, password+"2")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	pw, err = Get(service, user)
+	if err != nil || pw != password+"2" {
+		t.Errorf("Expected password %s, got %s, %v", password+"2", pw, err)
+	}
+	users, err := List(service)
+	if err != nil || len(users) != 1 {
+		t.Errorf("Expected exactly one user, got %v, %v", users, err)
+	}
+	attrs, err = GetAttributes(service, user)
+	if err != nil || attrs["state"] != "needs-reauth" {
+		t.Errorf("Expected the attributes to be kept, got %v, %v", attrs, err)
+	}
+
+	err = UpdateAttributes(service, user+"fake", map[string]string{"state": "ok"})
+	assertError(t, err, ErrNotFound)
+}
+
+// TestGetModified tests that a secret just set reports a recent change.
+func TestGetModified(t *testing.T) {
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer Delete(service, user)
+
+	modified, err := GetModified(service, user)
+	if err == ErrUnsupported {
+		t.Skip("modification times not supported by provider")
+	}
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if time.Since(modified) > time.Hour {
+		t.Errorf("Expected a recent modification, got %s", modified)
+	}
+}
+
+// TestRename tests moving a secret to another user.
+func TestRename(t *testing.T) {
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer DeleteAll(service)
+
+	err = Rename(service, user, user+"renamed")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	_, err = Get(service, user)
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+
+	pw, err := Get(service, user+"renamed")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	err = Rename(service, user, user+"2")
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+
+	err = Set(service, user, password+"2")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = Rename(service, user, user+"renamed")
+	if err != ErrAlreadyExists {
+		t.Errorf("Expected error ErrAlreadyExists, got %s", err)
+	}
+}
+
+// TestCopy tests copying a secret to another service.
+func TestCopy(t *testing.T) {
+	err := Set(service, user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	defer DeleteAll(service)
+	defer DeleteAll(service + "copy")
+
+	err = Copy(service, user, service+"copy", user, false)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	pw, err := Get(service+"copy", user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	// the source is kept
+	_, err = Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = Copy(service, user+"fake", service+"copy", user+"2", false)
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound, got %s", err)
+	}
+
+	err = Set(service, user, password+"2")
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = Copy(service, user, service+"copy", user, false)
+	if err != ErrAlreadyExists {
+		t.Errorf("Expected error ErrAlreadyExists, got %s", err)
+	}
+
+	err = Copy(service, user, service+"copy", user, true)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	pw, err = Get(service+"copy", user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password+"2" {
+		t.Errorf("Expected password %s, got %s", password+"2", pw)
+	}
+}
+
+// TestUnsupportedPlatform tests detecting the fallback provider's error as
+// ErrUnsupported.
+func TestUnsupportedPlatform(t *testing.T) {
+	err := fallbackServiceProvider{}.Set(service, user, password)
+	if err != ErrUnsupportedPlatform || !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected an error matching %s, got %s", ErrUnsupported, err)
+	}
+}
+
+// TestDeleteNonExistingProviders tests that every provider reports deleting
+// a missing secret with ErrNotFound, including wrapping ones, which must
+// pass it through unchanged.
+func TestDeleteNonExistingProviders(t *testing.T) {
+	providers := map[string]Keyring{
+		"default":  Provider(),
+		"mock":     NewMockProvider(),
+		"file":     NewFileProvider(filepath.Join(t.TempDir(), "secrets"), []byte("passphrase")),
+		"retry":    NewRetryProvider(NewMockProvider(), 3, time.Millisecond),
+		"obscured": NewObscuredNamesProvider(NewMockProvider(), []byte("salt")),
+	}
+	for name, k := range providers {
+		err := k.Delete(service, user+"-missing")
+		if err != ErrNotFound {
+			t.Errorf("%s: Expected error %s, got %v", name, ErrNotFound, err)
+		}
+
+		err = k.Set(service, user, password)
+		if err != nil {
+			t.Errorf("%s: Should not fail, got: %s", name, err)
+		}
+		err = k.Delete(service, user)
+		if err != nil {
+			t.Errorf("%s: Should not fail, got: %s", name, err)
+		}
+		err = k.Delete(service, user)
+		if err != ErrNotFound {
+			t.Errorf("%s: Expected error %s after deleting, got %v", name, ErrNotFound, err)
+		}
+	}
+}
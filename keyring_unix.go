@@ -3,180 +3,1388 @@
 package keyring
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	dbus "github.com/godbus/dbus/v5"
 	ss "github.com/zalando/go-keyring/secret_service"
 )
 
-type secretServiceProvider struct{}
+type secretServiceProvider struct {
+	// collection is the alias or label of the collection secrets are
+	// stored in, the login collection if empty.
+	collection string
+	// sessions keeps a session open across calls. A session is opened and
+	// closed for every call if nil.
+	sessions *sessionCache
+	// nonInteractive fails with ErrLocked instead of prompting the user to
+	// unlock a locked collection or item.
+	nonInteractive bool
+}
+
+// SecretServiceOption configures the provider returned by
+// NewSecretServiceProvider.
+type SecretServiceOption func(*secretServiceProvider)
+
+// WithNonInteractive makes the provider fail with ErrLocked right away
+// instead of prompting the user to unlock a locked collection, for
+// background processes which have no one to answer the prompt.
+func WithNonInteractive() SecretServiceOption {
+	return func(s *secretServiceProvider) {
+		s.nonInteractive = true
+	}
+}
+
+// NewSecretServiceProvider returns a Keyring storing secrets in the default
+// collection of the Secret Service, the one its "default" alias refers to or
+// else the login collection, configured by opts.
+func NewSecretServiceProvider(opts ...SecretServiceOption) Keyring {
+	return NewSecretServiceProviderWithCollection("", opts...)
+}
+
+// NewSecretServiceProviderWithCollection returns a Keyring storing secrets in
+// the Secret Service collection with the given alias or label instead of the
+// login collection. The collection is created on the first Set if it doesn't
+// exist.
+func NewSecretServiceProviderWithCollection(name string, opts ...SecretServiceOption) Keyring {
+	s := secretServiceProvider{collection: name, sessions: &sessionCache{}}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// setLocks serializes writes of the same service and user, so concurrent Set
+// calls can't each create an item.
+var setLocks keyedMutex
+
+// sessionCache keeps a Secret Service session open, so reading many secrets
+// doesn't open and close a session for each of them.
+type sessionCache struct {
+	mu sync.Mutex
+	// svc is the service session was opened on. Its session bus connection
+	// is shared and reopened by dbus.SessionBus once it's lost.
+	svc     *ss.SecretService
+	session *ss.Session
+}
+
+// open returns a session on svc and a function to call once done with it,
+// which closes the session unless it's cached. A nil cache opens a new
+// session every time. Sessions are encrypted unless the Secret Service only
+// supports plain ones.
+func (c *sessionCache) open(svc *ss.SecretService) (*ss.Session, func(), error) {
+	if c == nil {
+		session, err := svc.OpenEncryptedSession()
+		if err != nil {
+			return nil, nil, err
+		}
+		return session, func() { _ = svc.Close(session) }, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session != nil && c.svc.Conn == svc.Conn {
+		return c.session, func() {}, nil
+	}
+
+	session, err := svc.OpenEncryptedSession()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.svc, c.session = svc, session
+	return session, func() {}, nil
+}
+
+// invalidate drops the session at path from the cache after using it
+// failed, e.g. because the Secret Service was restarted, so the next call
+// opens a new one.
+func (c *sessionCache) invalidate(path dbus.ObjectPath) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session != nil && c.session.Path() == path {
+		c.svc, c.session = nil, nil
+	}
+}
+
+// closeSession closes the cached session, if any.
+func (s secretServiceProvider) closeSession() error {
+	c := s.sessions
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session == nil {
+		return nil
+	}
+
+	err := c.svc.Close(c.session)
+	c.svc, c.session = nil, nil
+	return err
+}
+
+// probe checks that the Secret Service answers by reading its collections,
+// which doesn't unlock any of them.
+func (s secretServiceProvider) probe() error {
+	svc, err := newSecretService()
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.Collections()
+	return err
+}
+
+// Describe returns the provider.
+func (s secretServiceProvider) Describe() []ProviderInfo {
+	config := map[string]string{}
+	if s.collection != "" {
+		config["collection"] = s.collection
+	}
+	if s.nonInteractive {
+		config["interactive"] = "false"
+	}
+	return []ProviderInfo{{Name: "secret-service", Config: config}}
+}
+
+// Persistent reports that Secret Service collections survive a reboot.
+func (s secretServiceProvider) Persistent() bool {
+	return true
+}
 
 // Set stores user and pass in the keyring under the defined service
-// name.
+// name. An existing item is replaced in place and any duplicates of it
+// deleted, so exactly one item is left whichever Secret Service is running.
 func (s secretServiceProvider) Set(service, user, pass string) error {
+	attributes := map[string]string{
+		"username": user,
+		"service":  service,
+	}
+
+	secret := ss.NewSecret("", pass)
+	defer wipe(secret.Value)
+
+	return s.set(service, user, secret, attributes, "")
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (s secretServiceProvider) SetBytes(service, user string, data []byte) error {
+	attributes := map[string]string{
+		"username": user,
+		"service":  service,
+	}
+
+	// copied, so wiping it doesn't touch the caller's data
+	secret := ss.NewBinarySecret("", append([]byte(nil), data...))
+	defer wipe(secret.Value)
+
+	return s.set(service, user, secret, attributes, "")
+}
+
+// SetWithLabel stores user and pass in the keyring under the defined service
+// name, labelled label instead of the default.
+func (s secretServiceProvider) SetWithLabel(service, user, pass, label string) error {
+	attributes := map[string]string{
+		"username": user,
+		"service":  service,
+	}
+
+	secret := ss.NewSecret("", pass)
+	defer wipe(secret.Value)
+
+	return s.set(service, user, secret, attributes, label)
+}
+
+// SetIfAbsent stores user and pass in the keyring under the defined service
+// name unless a secret is already stored for them.
+func (s secretServiceProvider) SetIfAbsent(service, user, pass string) error {
+	unlock := setLocks.lock(service + "\x00" + user)
+	defer unlock()
+
+	exists, err := s.Exists(service, user)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAlreadyExists
+	}
+
+	attributes := map[string]string{
+		"username": user,
+		"service":  service,
+	}
+
+	secret := ss.NewSecret("", pass)
+	defer wipe(secret.Value)
+
+	return s.store(secret, attributes, "")
+}
+
+// Rename moves the secret of oldUser to newUser by updating the username
+// attribute of its item, and its label if it's the default one.
+func (s secretServiceProvider) Rename(service, oldUser, newUser string) error {
+	// lock both users in a fixed order so concurrent renames can't deadlock
+	first, second := oldUser, newUser
+	if second < first {
+		first, second = second, first
+	}
+	unlockFirst := setLocks.lock(service + "\x00" + first)
+	defer unlockFirst()
+	if second != first {
+		unlockSecond := setLocks.lock(service + "\x00" + second)
+		defer unlockSecond()
+	}
+
+	svc, err := newSecretService()
+	if err != nil {
+		return err
+	}
+
+	collection, err := s.getCollection(svc, false)
+	if err != nil {
+		return err
+	}
+
+	item, err := s.findItem(svc, collection, service, oldUser)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.findItem(svc, collection, service, newUser)
+	if err == nil {
+		return ErrAlreadyExists
+	}
+	if err != ErrNotFound {
+		return err
+	}
+
+	attributes, err := svc.GetAttributes(item)
+	if err != nil {
+		return err
+	}
+	attributes["username"] = newUser
+
+	err = svc.SetAttributes(item, attributes)
+	if err != nil {
+		return err
+	}
+
+	info, err := svc.GetItemInfo(item)
+	if err != nil {
+		return err
+	}
+	if info.Label == fmt.Sprintf("Password for '%s' on '%s'", oldUser, service) {
+		return svc.SetLabel(item, fmt.Sprintf("Password for '%s' on '%s'", newUser, service))
+	}
+	return nil
+}
+
+// Copy copies the secret of srcService and srcUser to dstService and
+// dstUser over a single session, keeping its content type.
+func (s secretServiceProvider) Copy(srcService, srcUser, dstService, dstUser string, overwrite bool) error {
+	unlock := setLocks.lock(dstService + "\x00" + dstUser)
+	defer unlock()
+
+	svc, err := newSecretService()
+	if err != nil {
+		return err
+	}
+
+	session, done, err := s.sessions.open(svc)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	collection, err := s.getCollection(svc, false)
+	if err != nil {
+		return err
+	}
+
+	item, err := s.findItem(svc, collection, srcService, srcUser)
+	if err != nil {
+		return err
+	}
+
+	if !overwrite {
+		_, err = s.findItem(svc, collection, dstService, dstUser)
+		if err == nil {
+			return ErrAlreadyExists
+		}
+		if err != ErrNotFound {
+			return err
+		}
+	}
+
+	err = s.unlock(svc, item)
+	if err != nil {
+		return err
+	}
+
+	secret, err := svc.GetSecret(item, session.Path())
+	if err == ss.ErrLocked {
+		return ErrLocked
+	}
+	if err != nil {
+		s.sessions.invalidate(session.Path())
+		return err
+	}
+
+	value, err := session.Decrypt(secret)
+	if err != nil {
+		return err
+	}
+	defer wipe(value)
+	secret.Value = value
+
+	encrypted, err := session.Encrypt(*secret)
+	if err != nil {
+		return err
+	}
+
+	attributes := map[string]string{
+		"username": dstUser,
+		"service":  dstService,
+	}
+
+	return s.storeItem(svc, collection, encrypted, attributes, "")
+}
+
+// SetWithAttributes stores pass in the keyring under the defined service
+// name, tagged with the given attributes.
+func (s secretServiceProvider) SetWithAttributes(service string, attrs map[string]string, pass string) error {
+	secret := ss.NewSecret("", pass)
+	defer wipe(secret.Value)
+
+	return s.set(service, attrs["username"], secret, itemAttributes(service, attrs), "")
+}
+
+// set stores secret in the single item with exactly the given attributes,
+// creating it if it doesn't exist yet. secret is encrypted for the session
+// once it's opened. An empty label keeps the label of an existing item, or
+// uses the default for a new one.
+func (s secretServiceProvider) set(service, user string, secret ss.Secret, attributes map[string]string, label string) error {
+	unlock := setLocks.lock(service + "\x00" + user)
+	defer unlock()
+
+	return s.store(secret, attributes, label)
+}
+
+// store does the work of set. Callers must hold the set lock of service and
+// user.
+func (s secretServiceProvider) store(secret ss.Secret, attributes map[string]string, label string) error {
+	svc, err := newSecretService()
+	if err != nil {
+		return err
+	}
+
+	// open a session
+	session, done, err := s.sessions.open(svc)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	secret, err = session.Encrypt(secret)
+	if err != nil {
+		return err
+	}
+
+	collection, err := s.getCollection(svc, true)
+	if err != nil {
+		return err
+	}
+
+	err = s.unlock(svc, collection.Path())
+	if err != nil {
+		return err
+	}
+
+	return s.storeItem(svc, collection, secret, attributes, label)
+}
+
+// storeItem stores secret in the single item with the given attributes in
+// the unlocked collection, keeping any additional attributes it has. secret
+// must be encrypted for its session.
+func (s secretServiceProvider) storeItem(svc *ss.SecretService, collection dbus.BusObject, secret ss.Secret, attributes map[string]string, label string) error {
+	items, err := s.findStoredItems(svc, collection, attributes)
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		if label == "" && attributes["service"] == "" {
+			label = fmt.Sprintf("Password for '%s'", attributes["username"])
+		} else if label == "" {
+			label = fmt.Sprintf("Password for '%s' on '%s'", attributes["username"], attributes["service"])
+		}
+		err = svc.CreateItem(collection, label, attributes, secret)
+		if err != nil {
+			s.sessions.invalidate(secret.Session)
+		}
+		return err
+	}
+
+	// replace the secret in place and drop any duplicates
+	err = svc.SetSecret(items[0], secret)
+	if err != nil {
+		s.sessions.invalidate(secret.Session)
+		return err
+	}
+
+	if label != "" {
+		err = svc.SetLabel(items[0], label)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, item := range items[1:] {
+		err = svc.Delete(item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getCollection returns the collection secrets are stored in. A named
+// collection which doesn't exist is created if create is set, otherwise
+// ErrNotFound is returned.
+func (s secretServiceProvider) getCollection(svc *ss.SecretService, create bool) (dbus.BusObject, error) {
+	if s.collection == "" {
+		return svc.GetLoginCollection(), nil
+	}
+
+	collection, ok, err := svc.FindCollection(s.collection)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return collection, nil
+	}
+
+	if !create {
+		return nil, ErrNotFound
+	}
+	return svc.CreateCollection(s.collection)
+}
+
+// findStoredItems looks up the items a secret with the given attributes
+// replaces, the first one to keep and the others duplicates of it. Items
+// with exactly the given attributes are preferred. Otherwise the items having
+// additional attributes, e.g. set by UpdateAttributes or by the Secret
+// Service itself, are replaced if they're all copies of one item, and
+// ErrMultipleMatches is returned if they differ, e.g. secrets of the same
+// user stored with SetWithAttributes for different profiles.
+func (s secretServiceProvider) findStoredItems(svc *ss.SecretService, collection dbus.BusObject, attributes map[string]string) ([]dbus.ObjectPath, error) {
+	results, err := svc.SearchItems(collection, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	exact := []dbus.ObjectPath{}
+	all := make([]map[string]string, len(results))
+	for i, item := range results {
+		all[i], err = svc.GetAttributes(item)
+		if err != nil {
+			return nil, err
+		}
+		if len(all[i]) == len(attributes) {
+			exact = append(exact, item)
+		}
+	}
+	if len(exact) > 0 {
+		return exact, nil
+	}
+
+	for i := 1; i < len(all); i++ {
+		if !sameAttributes(all[i], all[0]) {
+			return nil, ErrMultipleMatches
+		}
+	}
+	return results, nil
+}
+
+// sameAttributes reports whether a and b hold the same attributes.
+func sameAttributes(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// findItem looksup an item by service and user.
+func (s secretServiceProvider) findItem(svc *ss.SecretService, collection dbus.BusObject, service, user string) (dbus.ObjectPath, error) {
+	search := map[string]string{
+		"username": user,
+		"service":  service,
+	}
+
+	err := s.unlock(svc, collection.Path())
+	if err != nil {
+		return "", err
+	}
+
+	results, err := svc.SearchItems(collection, search)
+	if err != nil {
+		return "", err
+	}
+
+	if len(results) == 0 {
+		return "", ErrNotFound
+	}
+
+	return results[0], nil
+}
+
+// findItemByAttributes looks up the single item matching all of the given
+// attributes.
+func (s secretServiceProvider) findItemByAttributes(svc *ss.SecretService, collection dbus.BusObject, search map[string]string) (dbus.ObjectPath, error) {
+	err := s.unlock(svc, collection.Path())
+	if err != nil {
+		return "", err
+	}
+
+	results, err := svc.SearchItems(collection, search)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(results) {
+	case 0:
+		return "", ErrNotFound
+	case 1:
+		return results[0], nil
+	default:
+		return "", ErrMultipleMatches
+	}
+}
+
+// findServiceItems looksup all items by service.
+func (s secretServiceProvider) findServiceItems(svc *ss.SecretService, collection dbus.BusObject, service string) ([]dbus.ObjectPath, error) {
+	search := map[string]string{
+		"service": service,
+	}
+
+	err := s.unlock(svc, collection.Path())
+	if err != nil {
+		return []dbus.ObjectPath{}, err
+	}
+
+	results, err := svc.SearchItems(collection, search)
+	if err != nil {
+		return []dbus.ObjectPath{}, err
+	}
+
+	if len(results) == 0 {
+		return []dbus.ObjectPath{}, ErrNotFound
+	}
+
+	return results, nil
+}
+
+// Get gets a secret from the keyring given a service name and a user.
+func (s secretServiceProvider) Get(service, user string) (string, error) {
+	secret, err := s.GetBytes(service, user)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(secret)
+
+	return string(secret), nil
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (s secretServiceProvider) GetBytes(service, user string) ([]byte, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := s.getCollection(svc, false)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.findItem(svc, collection, service, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getSecret(svc, item)
+}
+
+// GetWithAttributes gets the secret of the single item for service matching
+// all of the given attributes.
+func (s secretServiceProvider) GetWithAttributes(service string, attrs map[string]string) (string, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return "", err
+	}
+
+	collection, err := s.getCollection(svc, false)
+	if err != nil {
+		return "", err
+	}
+
+	item, err := s.findItemByAttributes(svc, collection, itemAttributes(service, attrs))
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := s.getSecret(svc, item)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(secret)
+
+	return string(secret), nil
+}
+
+// unlock unlocks the collection or item at path, prompting the user if
+// needed unless the provider is non-interactive.
+func (s secretServiceProvider) unlock(svc *ss.SecretService, path dbus.ObjectPath) error {
+	if s.nonInteractive {
+		return lockError(svc.UnlockNoPrompt(path))
+	}
+	return lockError(svc.Unlock(path))
+}
+
+// newSecretService connects to the Secret Service on the session bus. If
+// there's no session bus, or it can't be reached, the returned error wraps
+// ErrNoSessionBus.
+func newSecretService() (*ss.SecretService, error) {
 	svc, err := ss.NewSecretService()
+	if err != nil {
+		return nil, sessionBusError(err)
+	}
+	return svc, nil
+}
+
+// sessionBusError wraps ErrNoSessionBus in err, an error connecting to the
+// session bus, if there's no session bus or dialing it failed, rather than
+// the bus misbehaving.
+func sessionBusError(err error) error {
+	var opErr *net.OpError
+	if noSessionBus() || errors.As(err, &opErr) {
+		return fmt.Errorf("%w: %v", ErrNoSessionBus, err)
+	}
+	return err
+}
+
+// lockError maps the errors of the Secret Service about a locked collection
+// or item to ErrLocked and ErrPromptDismissed.
+func lockError(err error) error {
+	switch err {
+	case ss.ErrLocked:
+		return ErrLocked
+	case ss.ErrPromptDismissed:
+		return ErrPromptDismissed
+	}
+	return err
+}
+
+// getSecret reads the secret value of item.
+func (s secretServiceProvider) getSecret(svc *ss.SecretService, item dbus.ObjectPath) ([]byte, error) {
+	// open a session
+	session, done, err := s.sessions.open(svc)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	// unlock if invdividual item is locked
+	err = s.unlock(svc, item)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := svc.GetSecret(item, session.Path())
+	if err == ss.ErrLocked {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		s.sessions.invalidate(session.Path())
+		return nil, err
+	}
+
+	return session.Decrypt(secret)
+}
+
+// Exists reports whether a secret is stored for service and user without
+// retrieving it.
+func (s secretServiceProvider) Exists(service, user string) (bool, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return false, err
+	}
+
+	collection, err := s.getCollection(svc, false)
+	if err == nil {
+		_, err = s.findItem(svc, collection, service, user)
+	}
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring.
+func (s secretServiceProvider) Delete(service, user string) error {
+	svc, err := newSecretService()
+	if err != nil {
+		return err
+	}
+
+	collection, err := s.getCollection(svc, false)
 	if err != nil {
 		return err
 	}
 
-	// open a session
-	session, err := svc.OpenSession()
+	item, err := s.findItem(svc, collection, service, user)
 	if err != nil {
 		return err
 	}
-	defer svc.Close(session)
 
-	attributes := map[string]string{
-		"username": user,
-		"service":  service,
+	return svc.Delete(item)
+}
+
+// ExistsWithAttributes reports whether a single item for service matches all
+// of the given attributes.
+func (s secretServiceProvider) ExistsWithAttributes(service string, attrs map[string]string) (bool, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return false, err
 	}
 
-	secret := ss.NewSecret(session.Path(), pass)
+	collection, err := s.getCollection(svc, false)
+	if err == nil {
+		_, err = s.findItemByAttributes(svc, collection, itemAttributes(service, attrs))
+	}
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
 
-	collection := svc.GetLoginCollection()
+	return true, nil
+}
 
-	err = svc.Unlock(collection.Path())
+// DeleteWithAttributes deletes the single item for service matching all of
+// the given attributes.
+func (s secretServiceProvider) DeleteWithAttributes(service string, attrs map[string]string) error {
+	svc, err := newSecretService()
 	if err != nil {
 		return err
 	}
 
-	err = svc.CreateItem(collection,
-		fmt.Sprintf("Password for '%s' on '%s'", user, service),
-		attributes, secret)
+	collection, err := s.getCollection(svc, false)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	item, err := s.findItemByAttributes(svc, collection, itemAttributes(service, attrs))
+	if err != nil {
+		return err
+	}
+
+	return svc.Delete(item)
 }
 
-// findItem looksup an item by service and user.
-func (s secretServiceProvider) findItem(svc *ss.SecretService, service, user string) (dbus.ObjectPath, error) {
-	collection := svc.GetLoginCollection()
+// Find returns the attributes of all items matching all of the given
+// attributes.
+func (s secretServiceProvider) Find(attrs map[string]string) ([]map[string]string, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return nil, err
+	}
 
-	search := map[string]string{
-		"username": user,
-		"service":  service,
+	collection, err := s.getCollection(svc, false)
+	if err == ErrNotFound {
+		return []map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	err := svc.Unlock(collection.Path())
+	err = s.unlock(svc, collection.Path())
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	results, err := svc.SearchItems(collection, search)
+	results, err := svc.SearchItems(collection, attrs)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if len(results) == 0 {
-		return "", ErrNotFound
+	found := make([]map[string]string, 0, len(results))
+	for _, item := range results {
+		attributes, err := svc.GetAttributes(item)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, attributes)
 	}
 
-	return results[0], nil
+	return found, nil
 }
 
-// findServiceItems looksup all items by service.
-func (s secretServiceProvider) findServiceItems(svc *ss.SecretService, service string) ([]dbus.ObjectPath, error) {
-	collection := svc.GetLoginCollection()
+// GetAttributes returns the attributes of the item of service and user.
+func (s secretServiceProvider) GetAttributes(service, user string) (map[string]string, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return nil, err
+	}
 
-	search := map[string]string{
-		"service": service,
+	collection, err := s.getCollection(svc, false)
+	if err != nil {
+		return nil, err
 	}
 
-	err := svc.Unlock(collection.Path())
+	item, err := s.findItem(svc, collection, service, user)
 	if err != nil {
-		return []dbus.ObjectPath{}, err
+		return nil, err
 	}
 
-	results, err := svc.SearchItems(collection, search)
+	return svc.GetAttributes(item)
+}
+
+// UpdateAttributes sets attrs on the item of service and user, keeping its
+// secret and the attributes identifying it.
+func (s secretServiceProvider) UpdateAttributes(service, user string, attrs map[string]string) error {
+	unlock := setLocks.lock(service + "\x00" + user)
+	defer unlock()
+
+	svc, err := newSecretService()
 	if err != nil {
-		return []dbus.ObjectPath{}, err
+		return err
 	}
 
-	if len(results) == 0 {
-		return []dbus.ObjectPath{}, ErrNotFound
+	collection, err := s.getCollection(svc, false)
+	if err != nil {
+		return err
 	}
 
-	return results, nil
+	item, err := s.findItem(svc, collection, service, user)
+	if err != nil {
+		return err
+	}
+
+	attributes, err := svc.GetAttributes(item)
+	if err != nil {
+		return err
+	}
+	for k, v := range attrs {
+		if k != "service" && k != "username" {
+			attributes[k] = v
+		}
+	}
+
+	return svc.SetAttributes(item, attributes)
 }
 
-// Get gets a secret from the keyring given a service name and a user.
-func (s secretServiceProvider) Get(service, user string) (string, error) {
-	svc, err := ss.NewSecretService()
+// GetModified returns when the item of service and user was last changed.
+func (s secretServiceProvider) GetModified(service, user string) (time.Time, error) {
+	svc, err := newSecretService()
 	if err != nil {
-		return "", err
+		return time.Time{}, err
 	}
 
-	item, err := s.findItem(svc, service, user)
+	collection, err := s.getCollection(svc, false)
 	if err != nil {
-		return "", err
+		return time.Time{}, err
 	}
 
-	// open a session
-	session, err := svc.OpenSession()
+	item, err := s.findItem(svc, collection, service, user)
 	if err != nil {
-		return "", err
+		return time.Time{}, err
 	}
-	defer svc.Close(session)
 
-	// unlock if invdividual item is locked
-	err = svc.Unlock(item)
+	info, err := svc.GetItemInfo(item)
 	if err != nil {
-		return "", err
+		return time.Time{}, err
 	}
 
-	secret, err := svc.GetSecret(item, session.Path())
+	return info.Modified, nil
+}
+
+// List returns the users with a secret stored for a given service.
+func (s secretServiceProvider) List(service string) ([]string, error) {
+	svc, err := newSecretService()
 	if err != nil {
-		return "", err
+		return []string{}, err
+	}
+
+	collection, err := s.getCollection(svc, false)
+	if err != nil {
+		return []string{}, err
 	}
 
-	return string(secret.Value), nil
+	items, err := s.findServiceItems(svc, collection, service)
+	if err != nil {
+		return []string{}, err
+	}
+
+	users := make([]string, 0, len(items))
+	for _, item := range items {
+		attributes, err := svc.GetAttributes(item)
+		if err != nil {
+			return []string{}, err
+		}
+		users = append(users, attributes["username"])
+	}
+
+	return users, nil
 }
 
-// Delete deletes a secret, identified by service & user, from the keyring.
-func (s secretServiceProvider) Delete(service, user string) error {
-	svc, err := ss.NewSecretService()
+// SetMany stores the password of each user in entries under service, over a
+// single session and unlocking the collection once.
+func (s secretServiceProvider) SetMany(service string, entries map[string]string) error {
+	svc, err := newSecretService()
 	if err != nil {
 		return err
 	}
 
-	item, err := s.findItem(svc, service, user)
+	// open a session
+	session, done, err := s.sessions.open(svc)
 	if err != nil {
 		return err
 	}
+	defer done()
 
-	return svc.Delete(item)
+	collection, err := s.getCollection(svc, true)
+	if err != nil {
+		return err
+	}
+
+	err = s.unlock(svc, collection.Path())
+	if err != nil {
+		return err
+	}
+
+	for i, user := range sortedUsers(entries) {
+		attributes := map[string]string{
+			"username": user,
+			"service":  service,
+		}
+
+		// an unencrypted session sends the value as is, so it's wiped once
+		// stored
+		plain := ss.NewSecret("", entries[user])
+		secret, err := session.Encrypt(plain)
+		if err != nil {
+			wipe(plain.Value)
+			return &BatchError{Succeeded: i, User: user, Err: err}
+		}
+
+		unlock := setLocks.lock(service + "\x00" + user)
+		err = s.storeItem(svc, collection, secret, attributes, "")
+		unlock()
+		wipe(plain.Value)
+		if err != nil {
+			return &BatchError{Succeeded: i, User: user, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// GetMany gets the passwords of the given users of service, over a single
+// session and unlocking the collection once.
+func (s secretServiceProvider) GetMany(service string, users []string) (map[string]string, error) {
+	secrets := make(map[string]string, len(users))
+
+	svc, err := newSecretService()
+	if err != nil {
+		return secrets, err
+	}
+
+	collection, err := s.getCollection(svc, false)
+	if err == ErrNotFound {
+		return secrets, nil
+	}
+	if err != nil {
+		return secrets, err
+	}
+
+	// open a session
+	session, done, err := s.sessions.open(svc)
+	if err != nil {
+		return secrets, err
+	}
+	defer done()
+
+	err = s.unlock(svc, collection.Path())
+	if err != nil {
+		return secrets, err
+	}
+
+	for i, user := range users {
+		search := map[string]string{
+			"username": user,
+			"service":  service,
+		}
+
+		results, err := svc.SearchItems(collection, search)
+		if err != nil {
+			return secrets, &BatchError{Succeeded: i, User: user, Err: err}
+		}
+		if len(results) == 0 {
+			continue
+		}
+
+		secret, err := svc.GetSecret(results[0], session.Path())
+		if err == ss.ErrLocked {
+			return secrets, &BatchError{Succeeded: i, User: user, Err: ErrLocked}
+		}
+		if err != nil {
+			s.sessions.invalidate(session.Path())
+			return secrets, &BatchError{Succeeded: i, User: user, Err: err}
+		}
+		value, err := session.Decrypt(secret)
+		if err != nil {
+			return secrets, &BatchError{Succeeded: i, User: user, Err: err}
+		}
+		secrets[user] = string(value)
+		wipe(value)
+	}
+
+	return secrets, nil
 }
 
 // DeleteAll deletes all secrets for a given service
 func (s secretServiceProvider) DeleteAll(service string) error {
+	_, err := s.deleteAllCount(service)
+	return err
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted.
+func (s secretServiceProvider) deleteAllCount(service string) (int, error) {
 	// if service is empty, do nothing otherwise it might accidentally delete all secrets
 	if service == "" {
-		return ErrNotFound
+		return 0, ErrNotFound
 	}
 
-	svc, err := ss.NewSecretService()
+	svc, err := newSecretService()
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	return s.deleteServiceItems(svc, service)
+}
+
+// DeleteAllMulti deletes all secrets for each of the given services over a
+// single connection.
+func (s secretServiceProvider) DeleteAllMulti(services []string) (map[string]int, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make(map[string]int, len(services))
+	errs := ServiceErrors{}
+	for _, service := range services {
+		// if service is empty, do nothing otherwise it might accidentally delete all secrets
+		if service == "" {
+			errs[service] = ErrNotFound
+			continue
+		}
+
+		n, err := s.deleteServiceItems(svc, service)
+		if err != nil {
+			errs[service] = err
+			continue
+		}
+		deleted[service] = n
+	}
+
+	if len(errs) > 0 {
+		return deleted, errs
+	}
+	return deleted, nil
+}
+
+// deleteServiceItems deletes all items of a service and returns how many
+// were deleted.
+func (s secretServiceProvider) deleteServiceItems(svc *ss.SecretService, service string) (int, error) {
+	var items []dbus.ObjectPath
+	collection, err := s.getCollection(svc, false)
+	if err == nil {
+		// find all items for the service
+		items, err = s.findServiceItems(svc, collection, service)
 	}
-	// find all items for the service
-	items, err := s.findServiceItems(svc, service)
 	if err != nil {
 		if err == ErrNotFound {
-			return nil
+			return 0, nil
 		}
-		return err
+		return 0, err
 	}
-	for _, item := range items {
-		err = svc.Delete(item)
+	return svc.DeleteMany(items)
+}
+
+// inventory returns the metadata of all items in the collection.
+func (s secretServiceProvider) inventory() ([]InventoryItem, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := s.getCollection(svc, false)
+	if err == ErrNotFound {
+		return []InventoryItem{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := svc.GetItems(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]InventoryItem, 0, len(paths))
+	for _, path := range paths {
+		info, err := svc.GetItemInfo(path)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		items = append(items, InventoryItem{
+			Service:    info.Attributes["service"],
+			User:       info.Attributes["username"],
+			Label:      info.Label,
+			Attributes: info.Attributes,
+			Created:    &info.Created,
+			Modified:   &info.Modified,
+		})
 	}
-	return nil
+	return items, nil
+}
+
+// userItems returns the items of service and user with their info, newest
+// first by modification time.
+func (s secretServiceProvider) userItems(svc *ss.SecretService, service, user string) ([]dbus.ObjectPath, []*ss.ItemInfo, error) {
+	collection, err := s.getCollection(svc, false)
+	if err == ErrNotFound {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.unlock(svc, collection.Path())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paths, err := svc.SearchItems(collection, map[string]string{
+		"username": user,
+		"service":  service,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	infos := make([]*ss.ItemInfo, len(paths))
+	for i, path := range paths {
+		infos[i], err = svc.GetItemInfo(path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sort.Sort(byModified{paths, infos})
+	return paths, infos, nil
+}
+
+// byModified sorts items newest first by modification time.
+type byModified struct {
+	paths []dbus.ObjectPath
+	infos []*ss.ItemInfo
+}
+
+func (b byModified) Len() int { return len(b.paths) }
+
+func (b byModified) Less(i, j int) bool { return b.infos[i].Modified.After(b.infos[j].Modified) }
+
+func (b byModified) Swap(i, j int) {
+	b.paths[i], b.paths[j] = b.paths[j], b.paths[i]
+	b.infos[i], b.infos[j] = b.infos[j], b.infos[i]
+}
+
+// duplicates returns the items of service and user, newest first, if there's
+// more than one.
+func (s secretServiceProvider) duplicates(service, user string) ([]InventoryItem, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return nil, err
+	}
+
+	_, infos, err := s.userItems(svc, service, user)
+	if err != nil || len(infos) < 2 {
+		return nil, err
+	}
+
+	items := make([]InventoryItem, len(infos))
+	for i, info := range infos {
+		items[i] = InventoryItem{
+			Service:    service,
+			User:       user,
+			Label:      info.Label,
+			Attributes: info.Attributes,
+			Created:    &infos[i].Created,
+			Modified:   &infos[i].Modified,
+		}
+	}
+	return items, nil
+}
+
+// deduplicate deletes all but the newest item of service and user and
+// returns how many were deleted.
+func (s secretServiceProvider) deduplicate(service, user string) (int, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return 0, err
+	}
+
+	paths, _, err := s.userItems(svc, service, user)
+	if err != nil || len(paths) < 2 {
+		return 0, err
+	}
+
+	return svc.DeleteMany(paths[1:])
+}
+
+// Collections returns the labels of all collections in the secret service.
+func (s secretServiceProvider) Collections() ([]string, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.Collections()
+}
+
+// ActiveCollection returns the label of the collection secrets are stored in,
+// the one the "default" alias refers to unless the provider was given a
+// collection.
+func (s secretServiceProvider) ActiveCollection() (string, error) {
+	svc, err := newSecretService()
+	if err != nil {
+		return "", err
+	}
+
+	collection, err := s.getCollection(svc, false)
+	if err != nil {
+		return "", err
+	}
+
+	return svc.CollectionLabel(collection)
+}
+
+// Lock locks the collection.
+func (s secretServiceProvider) Lock() error {
+	svc, err := newSecretService()
+	if err != nil {
+		return err
+	}
+
+	collection, err := s.getCollection(svc, false)
+	if err != nil {
+		return err
+	}
+
+	return svc.Lock(collection.Path())
+}
+
+// inWSL reports whether the process runs in the Windows Subsystem for Linux.
+func inWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	_, err := os.Stat("/proc/sys/fs/binfmt_misc/WSLInterop")
+	return err == nil
+}
+
+// noSessionBus reports whether there's no session bus to connect to, as
+// neither $DBUS_SESSION_BUS_ADDRESS is set nor the bus socket exists in
+// $XDG_RUNTIME_DIR.
+func noSessionBus() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" {
+		return false
+	}
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(dir, "bus"))
+	return err != nil
+}
+
+// transientDBusError reports whether err tells that the Secret Service isn't
+// running, didn't reply or the bus went away, which may change by retrying.
+func transientDBusError(err error) bool {
+	var name string
+	var dbusErr dbus.Error
+	var dbusErrPtr *dbus.Error
+	switch {
+	case errors.As(err, &dbusErr):
+		name = dbusErr.Name
+	case errors.As(err, &dbusErrPtr):
+		name = dbusErrPtr.Name
+	default:
+		return false
+	}
+
+	switch name {
+	case "org.freedesktop.DBus.Error.ServiceUnknown",
+		"org.freedesktop.DBus.Error.NoReply",
+		"org.freedesktop.DBus.Error.Disconnected":
+		return true
+	}
+	return false
 }
 
 func init() {
-	provider = secretServiceProvider{}
+	defaultProvider = func() Keyring { return secretServiceProvider{sessions: &sessionCache{}} }
+	platformTransient = transientDBusError
+	sessionChecks = func(env *environment) {
+		env.sandbox = inSandbox
+		env.kde = inKDE
+		env.wsl = inWSL
+		env.noSessionBus = noSessionBus
+	}
+	backends["secret-service"] = func() Keyring { return NewSecretServiceProvider() }
+	backends["kwallet"] = NewKWalletProvider
+	backends["portal"] = NewPortalProvider
+	collectionBackend = func(name string) Keyring { return NewSecretServiceProviderWithCollection(name) }
 }
@@ -0,0 +1,529 @@
+//go:build (dragonfly && cgo) || (freebsd && cgo) || linux || netbsd || openbsd
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+	ss "github.com/zalando/go-keyring/secret_service"
+)
+
+// TestConcurrentSet tests that concurrent Set calls for the same service and
+// user leave exactly one item.
+func TestConcurrentSet(t *testing.T) {
+	s := secretServiceProvider{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := s.Set(service, user, fmt.Sprintf("%s%d", password, i))
+			if err != nil {
+				t.Errorf("Should not fail, got: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	defer s.DeleteAll(service)
+
+	svc, err := ss.NewSecretService()
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	items, err := s.findServiceItems(svc, svc.GetLoginCollection(), service)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	if len(items) != 1 {
+		t.Errorf("Expected exactly one item, got %d", len(items))
+	}
+}
+
+// TestConcurrentSession tests that goroutines sharing the cached session read
+// and write their own secrets.
+func TestConcurrentSession(t *testing.T) {
+	s := secretServiceProvider{sessions: &sessionCache{}}
+	defer s.closeSession()
+	defer s.DeleteAll(service)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := fmt.Sprintf("%s%d", user, i)
+			secret := fmt.Sprintf("%s%d", password, i)
+			for j := 0; j < 5; j++ {
+				err := s.Set(service, u, secret)
+				if err != nil {
+					t.Errorf("Should not fail, got: %s", err)
+					return
+				}
+				pw, err := s.Get(service, u)
+				if err != nil || pw != secret {
+					t.Errorf("Expected password %s, got %s, %v", secret, pw, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestPersistent tests that the Secret Service reports it survives reboots.
+func TestPersistent(t *testing.T) {
+	if !persistent(secretServiceProvider{}) {
+		t.Errorf("Expected Secret Service provider to be persistent")
+	}
+}
+
+// TestCollectionProvider tests storing secrets in a separate collection.
+func TestCollectionProvider(t *testing.T) {
+	k := NewSecretServiceProviderWithCollection("go-keyring-test")
+
+	err := k.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	defer k.DeleteAll(service)
+
+	pw, err := k.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	_, err = secretServiceProvider{}.Get(service, user)
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound in the login collection, got %s", err)
+	}
+
+	for p, label := range map[Keyring]string{
+		k:                       "go-keyring-test",
+		secretServiceProvider{}: "Login",
+	} {
+		active, err := p.(collectionKeyring).ActiveCollection()
+		if err != nil || active != label {
+			t.Errorf("Expected active collection %s, got %q, %v", label, active, err)
+		}
+	}
+
+	_, err = NewSecretServiceProviderWithCollection("go-keyring-missing").Get(service, user)
+	if err != ErrNotFound {
+		t.Errorf("Expected error ErrNotFound for a missing collection, got %s", err)
+	}
+
+	// deleting works on the same collection
+	err = k.Delete(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	_, err = k.Get(service, user)
+	assertError(t, err, ErrNotFound)
+
+	for _, u := range []string{user, user + "2"} {
+		if err := k.Set(service, u, password); err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+	}
+	n, err := deleteAllCount(k, service)
+	if err != nil || n != 2 {
+		t.Errorf("Expected 2 secrets deleted from the collection, got %d, %v", n, err)
+	}
+}
+
+// TestNonInteractive tests that a non-interactive provider works with an
+// unlocked collection, which needs no prompt.
+func TestNonInteractive(t *testing.T) {
+	k := NewSecretServiceProvider(WithNonInteractive())
+
+	err := k.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	defer k.DeleteAll(service)
+
+	pw, err := k.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	if config := describe(k)[0].Config; config["interactive"] != "false" {
+		t.Errorf("Expected the provider to be described as non-interactive, got %v", config)
+	}
+}
+
+// TestSetWithLabel tests that custom labels are set on new and existing
+// items, and kept by a later Set.
+func TestSetWithLabel(t *testing.T) {
+	s := secretServiceProvider{}
+	defer s.DeleteAll(service)
+
+	svc, err := ss.NewSecretService()
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	for _, label := range []string{"My App", "My Renamed App"} {
+		err = s.SetWithLabel(service, user, password, label)
+		if err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+
+		err = s.Set(service, user, password)
+		if err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+
+		item, err := s.findItem(svc, svc.GetLoginCollection(), service, user)
+		if err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+
+		info, err := svc.GetItemInfo(item)
+		if err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+		if info.Label != label {
+			t.Errorf("Expected label %q, got %q", label, info.Label)
+		}
+	}
+}
+
+// TestSessionCache tests that a session is reused until it's closed.
+func TestSessionCache(t *testing.T) {
+	s := secretServiceProvider{sessions: &sessionCache{}}
+
+	err := s.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	defer s.DeleteAll(service)
+
+	session := s.sessions.session
+	if session == nil {
+		t.Fatalf("Expected the session to be cached")
+	}
+
+	_, err = s.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if s.sessions.session != session {
+		t.Errorf("Expected the cached session to be reused")
+	}
+
+	err = s.closeSession()
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if s.sessions.session != nil {
+		t.Errorf("Expected the cached session to be dropped")
+	}
+
+	_, err = s.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail after closing the session, got: %s", err)
+	}
+}
+
+// BenchmarkGet measures reading a secret with and without a cached session.
+func BenchmarkGet(b *testing.B) {
+	for name, s := range map[string]secretServiceProvider{
+		"cached":   {sessions: &sessionCache{}},
+		"uncached": {},
+	} {
+		b.Run(name, func(b *testing.B) {
+			err := s.Set(service, user, password)
+			if err != nil {
+				b.Fatalf("Should not fail, got: %s", err)
+			}
+			defer s.DeleteAll(service)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := s.Get(service, user)
+				if err != nil {
+					b.Fatalf("Should not fail, got: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// TestSetGetManySecretService tests storing and reading several secrets over
+// one session.
+func TestSetGetManySecretService(t *testing.T) {
+	s := secretServiceProvider{sessions: &sessionCache{}}
+
+	err := s.SetMany(service, map[string]string{user: password, user + "2": password + "2"})
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	defer s.DeleteAll(service)
+
+	secrets, err := s.GetMany(service, []string{user, user + "2", user + "3"})
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(secrets) != 2 || secrets[user] != password || secrets[user+"2"] != password+"2" {
+		t.Errorf("Expected the secrets of %s and %s, got %v", user, user+"2", secrets)
+	}
+}
+
+// TestSessionBusError tests that a missing or unreachable session bus is
+// reported as ErrNoSessionBus, and other errors are kept.
+func TestSessionBusError(t *testing.T) {
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path=/run/missing")
+
+	dialErr := &net.OpError{Op: "dial", Net: "unix", Err: os.ErrNotExist}
+	if err := sessionBusError(dialErr); !errors.Is(err, ErrNoSessionBus) {
+		t.Errorf("Expected ErrNoSessionBus for an unreachable bus, got %v", err)
+	}
+
+	otherErr := errors.New("dbus: authentication failed")
+	if err := sessionBusError(otherErr); err != otherErr {
+		t.Errorf("Expected the error to be kept, got %v", err)
+	}
+
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	if err := sessionBusError(otherErr); !errors.Is(err, ErrNoSessionBus) {
+		t.Errorf("Expected ErrNoSessionBus without a session bus, got %v", err)
+	}
+}
+
+// createItem creates an item of service and user with the given additional
+// attributes in the login collection without replacing an existing one, like
+// some Secret Service versions do.
+func createItem(t *testing.T, svc *ss.SecretService, session dbus.BusObject, secret string, extra map[string]string) {
+	t.Helper()
+
+	attributes := map[string]string{"service": service, "username": user}
+	for k, v := range extra {
+		attributes[k] = v
+	}
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant(service),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(attributes),
+	}
+	var item, prompt dbus.ObjectPath
+	err := svc.GetLoginCollection().Call("org.freedesktop.Secret.Collection.CreateItem", 0,
+		properties, ss.NewSecret(session.Path(), secret), false).Store(&item, &prompt)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+}
+
+// TestDeduplicate tests that duplicate items of a service and user are
+// reported and all but the newest deleted.
+func TestDeduplicate(t *testing.T) {
+	old := provider
+	defer func() { provider = old }()
+	provider = secretServiceProvider{}
+	defer DeleteAll(service)
+
+	svc, err := ss.NewSecretService()
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	session, err := svc.OpenSession()
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	defer svc.Close(session)
+
+	for i, secret := range []string{password + "-old", password} {
+		if i > 0 {
+			// modification times have a resolution of a second
+			time.Sleep(1100 * time.Millisecond)
+		}
+		createItem(t, svc, session, secret, nil)
+	}
+
+	items, err := Duplicates(service, user)
+	if err != nil || len(items) != 2 || !items[0].Modified.After(*items[1].Modified) {
+		t.Fatalf("Expected 2 items, newest first, got %v, %v", items, err)
+	}
+
+	n, err := Deduplicate(service, user)
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 item deleted, got %d, %v", n, err)
+	}
+
+	items, err = Duplicates(service, user)
+	if err != nil || items != nil {
+		t.Errorf("Expected no duplicates, got %v, %v", items, err)
+	}
+
+	pw, err := Get(service, user)
+	if err != nil || pw != password {
+		t.Errorf("Expected the newest password %s, got %s, %v", password, pw, err)
+	}
+}
+
+// TestSetReplaces tests that Set replaces the item of a service and user in
+// place, keeping its attributes and dropping duplicates, so exactly one item
+// is left.
+func TestSetReplaces(t *testing.T) {
+	s := secretServiceProvider{}
+	defer s.DeleteAll(service)
+
+	svc, err := ss.NewSecretService()
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	session, err := svc.OpenSession()
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	defer svc.Close(session)
+
+	for i := 0; i < 2; i++ {
+		err = s.Set(service, user, fmt.Sprintf("%s%d", password, i))
+		if err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+
+		users, err := s.List(service)
+		if err != nil || len(users) != 1 {
+			t.Errorf("Expected exactly one user, got %v, %v", users, err)
+		}
+
+		// a duplicate left behind is dropped by the next Set
+		createItem(t, svc, session, password, nil)
+	}
+
+	items, err := s.duplicates(service, user)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("Expected the duplicate created last, got %v, %v", items, err)
+	}
+	err = s.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	items, err = s.duplicates(service, user)
+	if err != nil || items != nil {
+		t.Errorf("Expected no duplicates, got %v, %v", items, err)
+	}
+
+	// items with additional attributes are replaced in place as well, like
+	// those set by UpdateAttributes, SetWithAttributes or the Secret Service
+	// itself, including copies of them
+	for _, extra := range []map[string]string{
+		{"state": "needs-reauth"},
+		{"profile": "work"},
+		{"xdg:schema": "org.example.Password"},
+	} {
+		err = s.DeleteAll(service)
+		if err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+		createItem(t, svc, session, password, extra)
+		createItem(t, svc, session, password, extra)
+
+		err = s.Set(service, user, password+"2")
+		if err != nil {
+			t.Fatalf("Should not fail, got: %s", err)
+		}
+
+		users, err := s.List(service)
+		if err != nil || len(users) != 1 {
+			t.Errorf("Expected exactly one user, got %v, %v", users, err)
+		}
+		pw, err := s.Get(service, user)
+		if err != nil || pw != password+"2" {
+			t.Errorf("Expected password %s, got %s, %v", password+"2", pw, err)
+		}
+		attrs, err := s.GetAttributes(service, user)
+		if err != nil || len(attrs) != 3 {
+			t.Errorf("Expected the attributes %v to be kept, got %v, %v", extra, attrs, err)
+		}
+	}
+
+	// items differing in their additional attributes can't be told apart
+	createItem(t, svc, session, password, map[string]string{"profile": "home"})
+	err = s.Set(service, user, password)
+	assertError(t, err, ErrMultipleMatches)
+}
+
+// TestProbe tests that probing the Secret Service doesn't unlock a locked
+// collection.
+func TestProbe(t *testing.T) {
+	k := secretServiceProvider{}
+	if err := k.Lock(); err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	svc, err := ss.NewSecretService()
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	collection := svc.GetLoginCollection()
+	defer svc.Unlock(collection.Path())
+
+	if err := probe(k); err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	locked, err := collection.GetProperty("org.freedesktop.Secret.Collection.Locked")
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if locked.Value() != true {
+		t.Error("Expected the collection to stay locked")
+	}
+}
+
+// TestTransientDBusError tests that only errors of an unreachable Secret
+// Service are retried.
+func TestTransientDBusError(t *testing.T) {
+	for name, want := range map[string]bool{
+		"org.freedesktop.DBus.Error.ServiceUnknown": true,
+		"org.freedesktop.DBus.Error.NoReply":        true,
+		"org.freedesktop.DBus.Error.Disconnected":   true,
+		"org.freedesktop.DBus.Error.AccessDenied":   false,
+		"org.freedesktop.DBus.Error.UnknownMethod":  false,
+	} {
+		err := fmt.Errorf("get: %w", dbus.Error{Name: name})
+		if got := transient(err); got != want {
+			t.Errorf("%s: expected transient %v, got %v", name, want, got)
+		}
+	}
+}
+
+// TestSetBytesKeepsData tests that wiping the secret sent to the Secret
+// Service leaves the caller's data alone.
+func TestSetBytesKeepsData(t *testing.T) {
+	k := secretServiceProvider{}
+	data := []byte(password)
+
+	err := k.SetBytes(service, user, data)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	defer k.DeleteAll(service)
+
+	if string(data) != password {
+		t.Errorf("Expected the data to be kept, got %q", data)
+	}
+	stored, err := k.GetBytes(service, user)
+	if err != nil || string(stored) != password {
+		t.Errorf("Expected %s to be stored, got %q, %v", password, stored, err)
+	}
+}
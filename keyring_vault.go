@@ -0,0 +1,317 @@
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// vaultTimeout limits the requests of the default client of the Vault
+// provider, so an unresponsive server doesn't block callers forever.
+const vaultTimeout = 30 * time.Second
+
+// vaultProvider stores secrets in a HashiCorp Vault KV version 2 secrets
+// engine, at mount/data/service/user.
+type vaultProvider struct {
+	address string
+	token   string
+	mount   string
+	client  *http.Client
+	ctx     context.Context
+}
+
+// VaultOption configures the provider returned by NewVaultProvider.
+type VaultOption func(*vaultProvider)
+
+// WithVaultClient makes the provider send its requests with client, e.g. to
+// configure TLS or another timeout. The default client gives up on requests
+// after 30 seconds.
+func WithVaultClient(client *http.Client) VaultOption {
+	return func(v *vaultProvider) {
+		v.client = client
+	}
+}
+
+// WithVaultContext makes the provider send its requests with ctx, so
+// canceling it, e.g. on shutdown, aborts pending and later calls.
+func WithVaultContext(ctx context.Context) VaultOption {
+	return func(v *vaultProvider) {
+		v.ctx = ctx
+	}
+}
+
+// NewVaultProvider returns a Keyring storing secrets in the KV version 2
+// secrets engine mounted at mount of the Vault server at address, e.g.
+// "https://vault.example.com:8200", authenticating with token. The secret of
+// service and user is kept in the "secret" key of the Vault secret at
+// service/user. Deleting a secret removes all of its versions.
+//
+// Users may not contain a slash, and services may only contain slashes
+// between non-empty path segments, which Vault shows as folders. The
+// provider is never selected automatically; install it with SetProvider.
+func NewVaultProvider(address, token, mount string, opts ...VaultOption) Keyring {
+	v := vaultProvider{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		client:  &http.Client{Timeout: vaultTimeout},
+		ctx:     context.Background(),
+	}
+	for _, opt := range opts {
+		opt(&v)
+	}
+	return v
+}
+
+// vaultData is the data of a Vault secret written by the provider. Secrets
+// which aren't valid UTF-8 are base64 encoded, as JSON strings can't hold
+// them.
+type vaultData struct {
+	Secret       string `json:"secret,omitempty"`
+	SecretBase64 string `json:"secret_base64,omitempty"`
+}
+
+// Describe returns the provider with the server and mount, but not the
+// token.
+func (v vaultProvider) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "vault", Config: map[string]string{
+		"address": v.address,
+		"mount":   v.mount,
+	}}}
+}
+
+// Persistent reports that the server keeps secrets across reboots.
+func (v vaultProvider) Persistent() bool {
+	return true
+}
+
+// path returns the API path of the secret of service and user below the
+// given part of the mount, "data" or "metadata".
+func (v vaultProvider) path(part, service, user string) (string, error) {
+	if user == "" || strings.Contains(user, "/") {
+		return "", fmt.Errorf("invalid vault user %q", user)
+	}
+	if err := checkVaultService(service); err != nil {
+		return "", err
+	}
+	return v.mount + "/" + part + "/" + service + "/" + user, nil
+}
+
+// checkVaultService refuses services with empty or relative path segments,
+// which would address another secret.
+func checkVaultService(service string) error {
+	for _, part := range strings.Split(service, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid vault service %q", service)
+		}
+	}
+	return nil
+}
+
+// request sends a request to the API and decodes the data of the response
+// into result, if not nil. ErrNotFound is returned for a 404 response.
+func (v vaultProvider) request(method, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		defer wipe(data)
+		reader = bytes.NewReader(data)
+	}
+
+	u := v.address + "/v1/" + (&url.URL{Path: path}).EscapedPath()
+	req, err := http.NewRequestWithContext(v.ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		if len(errResp.Errors) > 0 {
+			return fmt.Errorf("vault: %s %s: %s: %s", method, path, resp.Status, strings.Join(errResp.Errors, "; "))
+		}
+		return fmt.Errorf("vault: %s %s: %s", method, path, resp.Status)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(&struct {
+		Data interface{} `json:"data"`
+	}{result})
+}
+
+// Set stores user and pass in the keyring under the defined service name.
+func (v vaultProvider) Set(service, user, pass string) error {
+	return v.write(service, user, vaultData{Secret: pass})
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (v vaultProvider) SetBytes(service, user string, data []byte) error {
+	if utf8.Valid(data) {
+		return v.write(service, user, vaultData{Secret: string(data)})
+	}
+	return v.write(service, user, vaultData{SecretBase64: base64.StdEncoding.EncodeToString(data)})
+}
+
+// write stores data as a new version of the secret of service and user.
+func (v vaultProvider) write(service, user string, data vaultData) error {
+	path, err := v.path("data", service, user)
+	if err != nil {
+		return err
+	}
+	return v.request(http.MethodPost, path, map[string]vaultData{"data": data}, nil)
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (v vaultProvider) GetBytes(service, user string) ([]byte, error) {
+	path, err := v.path("data", service, user)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret struct {
+		Data vaultData `json:"data"`
+	}
+	err = v.request(http.MethodGet, path, nil, &secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret.Data.SecretBase64 != "" {
+		return base64.StdEncoding.DecodeString(secret.Data.SecretBase64)
+	}
+	return []byte(secret.Data.Secret), nil
+}
+
+// Get gets a secret from the keyring given a service name and a user.
+func (v vaultProvider) Get(service, user string) (string, error) {
+	data, err := v.GetBytes(service, user)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(data)
+
+	return string(data), nil
+}
+
+// Exists reports whether a secret is stored for service and user, by
+// reading its metadata rather than its data.
+func (v vaultProvider) Exists(service, user string) (bool, error) {
+	path, err := v.path("metadata", service, user)
+	if err != nil {
+		return false, err
+	}
+
+	err = v.request(http.MethodGet, path, nil, nil)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete deletes a secret, identified by service & user, from the keyring,
+// with all of its versions.
+func (v vaultProvider) Delete(service, user string) error {
+	ok, err := v.Exists(service, user)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+
+	path, err := v.path("metadata", service, user)
+	if err != nil {
+		return err
+	}
+	return v.request(http.MethodDelete, path, nil, nil)
+}
+
+// List returns the users with a secret stored for a given service. Folders
+// of services nested below it are left out.
+func (v vaultProvider) List(service string) ([]string, error) {
+	if err := checkVaultService(service); err != nil {
+		return []string{}, err
+	}
+
+	var list struct {
+		Keys []string `json:"keys"`
+	}
+	err := v.request("LIST", v.mount+"/metadata/"+service, nil, &list)
+	if err != nil {
+		return []string{}, err
+	}
+
+	users := []string{}
+	for _, key := range list.Keys {
+		if !strings.HasSuffix(key, "/") {
+			users = append(users, key)
+		}
+	}
+	if len(users) == 0 {
+		return users, ErrNotFound
+	}
+	return users, nil
+}
+
+// DeleteAll deletes all secrets for a given service
+func (v vaultProvider) DeleteAll(service string) error {
+	_, err := v.deleteAllCount(service)
+	return err
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted.
+func (v vaultProvider) deleteAllCount(service string) (int, error) {
+	// if service is empty, do nothing otherwise it might accidentally delete all secrets
+	if service == "" {
+		return 0, ErrNotFound
+	}
+
+	users, err := v.List(service)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, user := range users {
+		err = v.request(http.MethodDelete, v.mount+"/metadata/"+service+"/"+user, nil, nil)
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
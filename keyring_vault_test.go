@@ -0,0 +1,191 @@
+package keyring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault implements the parts of the KV version 2 API used by the vault
+// provider, for the mount "kv".
+type fakeVault struct {
+	mu      sync.Mutex
+	secrets map[string]json.RawMessage
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "token" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	part, name, _ := strings.Cut(path, "/")
+	reply := func(data interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+
+	switch {
+	case part == "data" && r.Method == http.MethodPost:
+		var body struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.secrets[name] = body.Data
+		reply(map[string]int{"version": 1})
+	case part == "data" && r.Method == http.MethodGet:
+		data, ok := f.secrets[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		reply(map[string]json.RawMessage{"data": data})
+	case part == "metadata" && r.Method == http.MethodGet:
+		if _, ok := f.secrets[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		reply(map[string]int{"current_version": 1})
+	case part == "metadata" && r.Method == http.MethodDelete:
+		delete(f.secrets, name)
+		w.WriteHeader(http.StatusNoContent)
+	case part == "metadata" && r.Method == "LIST":
+		keys := []string{}
+		seen := map[string]bool{}
+		for n := range f.secrets {
+			if strings.HasPrefix(n, name+"/") {
+				rest := strings.TrimPrefix(n, name+"/")
+				if dir, _, nested := strings.Cut(rest, "/"); nested {
+					rest = dir + "/"
+				}
+				if !seen[rest] {
+					seen[rest] = true
+					keys = append(keys, rest)
+				}
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sort.Strings(keys)
+		reply(map[string][]string{"keys": keys})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// TestVaultProvider tests storing secrets in a KV version 2 engine.
+func TestVaultProvider(t *testing.T) {
+	server := httptest.NewServer(&fakeVault{secrets: map[string]json.RawMessage{}})
+	defer server.Close()
+
+	vp := NewVaultProvider(server.URL, "token", "kv")
+
+	_, err := vp.Get(service, user)
+	assertError(t, err, ErrNotFound)
+
+	err = vp.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	pw, err := vp.Get(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if pw != password {
+		t.Errorf("Expected password %s, got %s", password, pw)
+	}
+
+	binary := []byte{0xff, 0x00, 0xfe}
+	err = vp.SetBytes(service, user+"2", binary)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	data, err := vp.GetBytes(service, user+"2")
+	if err != nil || string(data) != string(binary) {
+		t.Errorf("Expected data %v, got %v, %v", binary, data, err)
+	}
+
+	// a nested service shows up as a folder, which isn't a user
+	err = vp.Set(service+"/nested", user, password)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	users, err := vp.List(service)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+	if len(users) != 2 || users[0] != user || users[1] != user+"2" {
+		t.Errorf("Expected users %s and %s, got %v", user, user+"2", users)
+	}
+
+	err = vp.Set(service, "../"+user, password)
+	if err == nil {
+		t.Errorf("Expected users with a slash to be refused")
+	}
+
+	err = vp.Delete(service, user)
+	if err != nil {
+		t.Errorf("Should not fail, got: %s", err)
+	}
+
+	err = vp.Delete(service, user)
+	assertError(t, err, ErrNotFound)
+
+	n, err := deleteAllCount(vp, service)
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 deleted secret, got %d, %v", n, err)
+	}
+
+	ok, err := vp.Exists(service+"/nested", user)
+	if err != nil || !ok {
+		t.Errorf("Expected the nested service to be kept, got %t, %v", ok, err)
+	}
+
+	_, err = NewVaultProvider(server.URL, "wrong", "kv").Get(service, user)
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Expected the error of the server, got %v", err)
+	}
+}
+
+// TestVaultProviderTimeout tests that requests to an unresponsive server
+// give up after the timeout of the client or once the context is canceled.
+func TestVaultProviderTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	vp := NewVaultProvider(server.URL, "token", "kv", WithVaultClient(&http.Client{Timeout: 50 * time.Millisecond}))
+	_, err := vp.Get(service, user)
+	if err == nil {
+		t.Errorf("Expected the request to time out")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewVaultProvider(server.URL, "token", "kv", WithVaultContext(ctx)).Get(service, user)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
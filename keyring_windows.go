@@ -1,32 +1,145 @@
 package keyring
 
 import (
-	"strings"
 	"syscall"
 
 	"github.com/danieljoos/wincred"
 )
 
-type windowsKeychain struct{}
+type windowsKeychain struct {
+	// codec builds credential target names, ColonNameCodec if nil.
+	codec NameCodec
+	// persistence is the lifetime of stored credentials.
+	persistence Persistence
+}
+
+// Persistence is the lifetime of the credentials stored in the Windows
+// Credential Manager.
+type Persistence int
+
+const (
+	// PersistLocalMachine keeps credentials across logon sessions of the
+	// user on this computer. It's the default.
+	PersistLocalMachine Persistence = iota
+	// PersistSession keeps credentials only until the user logs off.
+	PersistSession
+	// PersistEnterprise keeps credentials across logon sessions and lets
+	// them roam to other computers of a domain user with a roaming profile.
+	PersistEnterprise
+)
+
+// String returns the name of the persistence.
+func (p Persistence) String() string {
+	switch p {
+	case PersistSession:
+		return "session"
+	case PersistEnterprise:
+		return "enterprise"
+	default:
+		return "local-machine"
+	}
+}
+
+// credentialPersistence returns the Persist value of CREDENTIAL for p.
+func (p Persistence) credentialPersistence() wincred.CredentialPersistence {
+	switch p {
+	case PersistSession:
+		return wincred.PersistSession
+	case PersistEnterprise:
+		return wincred.PersistEnterprise
+	default:
+		return wincred.PersistLocalMachine
+	}
+}
+
+// WindowsOption configures the provider returned by NewWindowsProvider.
+type WindowsOption func(*windowsKeychain)
+
+// WithPersistence stores credentials with the given persistence instead of
+// PersistLocalMachine. It applies to credentials written by the provider;
+// existing credentials keep theirs until they're set again.
+func WithPersistence(p Persistence) WindowsOption {
+	return func(k *windowsKeychain) {
+		k.persistence = p
+	}
+}
+
+// NewWindowsProvider returns a Keyring using the Windows Credential Manager
+// with credential target names built by codec, e.g. AtNameCodec to share
+// credentials with Python's keyring.
+func NewWindowsProvider(codec NameCodec, opts ...WindowsOption) Keyring {
+	k := windowsKeychain{codec: codec}
+	for _, opt := range opts {
+		opt(&k)
+	}
+	return k
+}
+
+// Describe returns the provider and its persistence.
+func (k windowsKeychain) Describe() []ProviderInfo {
+	return []ProviderInfo{{Name: "credential-manager", Config: map[string]string{
+		"persistence": k.persistence.String(),
+	}}}
+}
+
+// Persistent reports whether credentials survive a reboot, which they do
+// unless they're stored with session persistence.
+func (k windowsKeychain) Persistent() bool {
+	return k.persistence != PersistSession
+}
 
 // Get gets a secret from the keyring given a service name and a user.
 func (k windowsKeychain) Get(service, username string) (string, error) {
+	secret, err := k.GetBytes(service, username)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(secret)
+
+	return string(secret), nil
+}
+
+// GetBytes gets binary data from the keyring given a service name and a
+// user.
+func (k windowsKeychain) GetBytes(service, username string) ([]byte, error) {
 	cred, err := wincred.GetGenericCredential(k.credName(service, username))
 	if err != nil {
 		if err == syscall.ERROR_NOT_FOUND {
-			return "", ErrNotFound
+			return nil, ErrNotFound
 		}
-		return "", err
+		return nil, err
 	}
 
-	return string(cred.CredentialBlob), nil
+	return cred.CredentialBlob, nil
+}
+
+// Exists reports whether a credential is stored for service and username.
+func (k windowsKeychain) Exists(service, username string) (bool, error) {
+	_, err := wincred.GetGenericCredential(k.credName(service, username))
+	if err == syscall.ERROR_NOT_FOUND {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
 // Set stores stores user and pass in the keyring under the defined service
 // name.
 func (k windowsKeychain) Set(service, username, password string) error {
+	data := []byte(password)
+	defer wipe(data)
+
+	return k.SetBytes(service, username, data)
+}
+
+// SetBytes stores user and binary data in the keyring under the defined
+// service name.
+func (k windowsKeychain) SetBytes(service, username string, data []byte) error {
 	// password may not exceed 2560 bytes (https://github.com/jaraco/keyring/issues/540#issuecomment-968329967)
-	if len(password) > 2560 {
+	if len(data) > 2560 {
 		return ErrSetDataTooBig
 	}
 
@@ -43,7 +156,8 @@ func (k windowsKeychain) Set(service, username, password string) error {
 
 	cred := wincred.NewGenericCredential(k.credName(service, username))
 	cred.UserName = username
-	cred.CredentialBlob = []byte(password)
+	cred.CredentialBlob = data
+	cred.Persist = k.persistence.credentialPersistence()
 	return cred.Write()
 }
 
@@ -60,44 +174,106 @@ func (k windowsKeychain) Delete(service, username string) error {
 	return cred.Delete()
 }
 
+// List returns the users with a secret stored for a given service.
+func (k windowsKeychain) List(service string) ([]string, error) {
+	creds, err := wincred.List()
+	if err != nil {
+		return []string{}, err
+	}
+
+	users := []string{}
+	for _, cred := range creds {
+		if cred.TargetName == k.credName(service, cred.UserName) {
+			users = append(users, cred.UserName)
+		}
+	}
+
+	if len(users) == 0 {
+		return users, ErrNotFound
+	}
+	return users, nil
+}
+
+// DeleteAll deletes all secrets for a given service
 func (k windowsKeychain) DeleteAll(service string) error {
+	_, err := k.deleteAllCount(service)
+	return err
+}
+
+// deleteAllCount deletes all secrets for a given service and returns how
+// many were deleted.
+func (k windowsKeychain) deleteAllCount(service string) (int, error) {
 	// if service is empty, do nothing otherwise it might accidentally delete all secrets
 	if service == "" {
-		return ErrNotFound
+		return 0, ErrNotFound
 	}
 
 	creds, err := wincred.List()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	prefix := k.credName(service, "")
 	deletedCount := 0
 
 	for _, cred := range creds {
-		if strings.HasPrefix(cred.TargetName, prefix) {
+		if cred.TargetName == k.credName(service, cred.UserName) {
 			genericCred, err := wincred.GetGenericCredential(cred.TargetName)
 			if err != nil {
 				if err != syscall.ERROR_NOT_FOUND {
-					return err
+					return deletedCount, err
 				}
 			} else {
 				err := genericCred.Delete()
 				if err != nil {
-					return err
+					return deletedCount, err
 				}
 				deletedCount++
 			}
 		}
 	}
-	return nil
+	return deletedCount, nil
+}
+
+// inventory returns the metadata of all generic credentials. The service is
+// recovered from the target name where the codec can decode it.
+func (k windowsKeychain) inventory() ([]InventoryItem, error) {
+	creds, err := wincred.List()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]InventoryItem, 0, len(creds))
+	for _, cred := range creds {
+		service, _, ok := k.nameCodec().Decode(cred.TargetName)
+		if !ok {
+			service = cred.TargetName
+		}
+		modified := cred.LastWritten
+		size := len(cred.CredentialBlob)
+		items = append(items, InventoryItem{
+			Service:  service,
+			User:     cred.UserName,
+			Modified: &modified,
+			Size:     &size,
+		})
+	}
+	return items, nil
 }
 
 // credName combines service and username to a single string.
 func (k windowsKeychain) credName(service, username string) string {
-	return service + ":" + username
+	return k.nameCodec().Encode(service, username)
+}
+
+// nameCodec returns the codec used for target names.
+func (k windowsKeychain) nameCodec() NameCodec {
+	if k.codec == nil {
+		return ColonNameCodec
+	}
+	return k.codec
 }
 
 func init() {
-	provider = windowsKeychain{}
+	defaultProvider = func() Keyring { return windowsKeychain{} }
+	backends["credential-manager"] = func() Keyring { return windowsKeychain{} }
 }
@@ -0,0 +1,29 @@
+package keyring
+
+import (
+	"testing"
+
+	"github.com/danieljoos/wincred"
+)
+
+// TestWithPersistence tests storing credentials with session persistence.
+func TestWithPersistence(t *testing.T) {
+	k := NewWindowsProvider(nil, WithPersistence(PersistSession))
+	if persistent(k) {
+		t.Errorf("Expected session credentials not to be persistent")
+	}
+
+	err := k.Set(service, user, password)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	defer k.Delete(service, user)
+
+	cred, err := wincred.GetGenericCredential(ColonNameCodec.Encode(service, user))
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if cred.Persist != wincred.PersistSession {
+		t.Errorf("Expected session persistence, got %d", cred.Persist)
+	}
+}
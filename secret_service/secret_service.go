@@ -1,11 +1,21 @@
 package ss
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
 
 	"errors"
 
 	dbus "github.com/godbus/dbus/v5"
+	"golang.org/x/crypto/hkdf"
 )
 
 const (
@@ -20,6 +30,29 @@ const (
 
 	loginCollectionAlias = "/org/freedesktop/secrets/aliases/default"
 	collectionBasePath   = "/org/freedesktop/secrets/collection/"
+
+	isLockedError     = "org.freedesktop.Secret.Error.IsLocked"
+	notSupportedError = "org.freedesktop.DBus.Error.NotSupported"
+
+	algorithmPlain = "plain"
+	algorithmDH    = "dh-ietf1024-sha256-aes128-cbc-pkcs7"
+)
+
+// dhPrime is the 1024 bit MODP group of RFC 2409, section 6.2, used with the
+// generator 2 by the dh-ietf1024-sha256-aes128-cbc-pkcs7 algorithm.
+var dhPrime, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381FFFFFFFFFFFFFFFF", 16)
+
+var (
+	// ErrLocked is returned if a collection or item is locked and couldn't
+	// be unlocked.
+	ErrLocked = errors.New("secret service collection is locked")
+	// ErrPromptDismissed is returned if the user dismissed the prompt to
+	// unlock a collection.
+	ErrPromptDismissed = errors.New("secret service prompt was dismissed")
 )
 
 // Secret defines a org.freedesk.Secret.Item secret struct.
@@ -40,7 +73,27 @@ func NewSecret(session dbus.ObjectPath, secret string) Secret {
 	}
 }
 
-// SecretService is an interface for the Secret Service dbus API.
+// NewBinarySecret initializes a new Secret holding arbitrary bytes.
+func NewBinarySecret(session dbus.ObjectPath, value []byte) Secret {
+	return Secret{
+		Session:     session,
+		Parameters:  []byte{},
+		Value:       value,
+		ContentType: "application/octet-stream",
+	}
+}
+
+// ItemInfo holds the metadata of an item.
+type ItemInfo struct {
+	Label      string
+	Attributes map[string]string
+	Created    time.Time
+	Modified   time.Time
+}
+
+// SecretService is an interface for the Secret Service dbus API. It's safe
+// for concurrent use, as is a Session opened on it, which only holds the
+// negotiated key.
 type SecretService struct {
 	*dbus.Conn
 	object dbus.BusObject
@@ -53,17 +106,24 @@ func NewSecretService() (*SecretService, error) {
 		return nil, err
 	}
 
+	return NewSecretServiceWithConn(conn), nil
+}
+
+// NewSecretServiceWithConn initializes a new SecretService object talking to
+// the secret service on conn instead of the session bus, e.g. a connection to
+// a private bus of a test or a sandbox.
+func NewSecretServiceWithConn(conn *dbus.Conn) *SecretService {
 	return &SecretService{
 		conn,
 		conn.Object(serviceName, servicePath),
-	}, nil
+	}
 }
 
 // OpenSession opens a secret service session.
 func (s *SecretService) OpenSession() (dbus.BusObject, error) {
 	var disregard dbus.Variant
 	var sessionPath dbus.ObjectPath
-	err := s.object.Call(serviceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&disregard, &sessionPath)
+	err := s.object.Call(serviceInterface+".OpenSession", 0, algorithmPlain, dbus.MakeVariant("")).Store(&disregard, &sessionPath)
 	if err != nil {
 		return nil, err
 	}
@@ -71,6 +131,145 @@ func (s *SecretService) OpenSession() (dbus.BusObject, error) {
 	return s.Object(serviceName, sessionPath), nil
 }
 
+// Session is an open secret service session. Secrets sent over it must be
+// prepared with Encrypt, and secrets received over it read with Decrypt.
+type Session struct {
+	dbus.BusObject
+	// key is the AES-128 key of an encrypted session, nil for a plain one.
+	key []byte
+}
+
+// OpenEncryptedSession opens a session whose secrets are encrypted with an
+// AES key negotiated by Diffie-Hellman key exchange, so other processes on
+// the bus can't read them. A plain session is opened instead if the service
+// doesn't support the dh-ietf1024-sha256-aes128-cbc-pkcs7 algorithm.
+func (s *SecretService) OpenEncryptedSession() (*Session, error) {
+	private, public, err := dhKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	var output dbus.Variant
+	var sessionPath dbus.ObjectPath
+	err = s.object.Call(serviceInterface+".OpenSession", 0, algorithmDH, dbus.MakeVariant(public.Bytes())).
+		Store(&output, &sessionPath)
+	if e, ok := err.(dbus.Error); ok && e.Name == notSupportedError {
+		session, err := s.OpenSession()
+		if err != nil {
+			return nil, err
+		}
+		return &Session{BusObject: session}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	peer, ok := output.Value().([]byte)
+	if !ok {
+		return nil, fmt.Errorf("invalid public key of type %s", output.Signature())
+	}
+
+	key, err := dhSessionKey(private, peer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{BusObject: s.Object(serviceName, sessionPath), key: key}, nil
+}
+
+// dhKeyPair generates a Diffie-Hellman key pair in the group of dhPrime.
+func dhKeyPair() (private, public *big.Int, err error) {
+	one := big.NewInt(1)
+	for private == nil || private.Cmp(one) <= 0 {
+		private, err = rand.Int(rand.Reader, dhPrime)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return private, new(big.Int).Exp(big.NewInt(2), private, dhPrime), nil
+}
+
+// dhSessionKey derives the AES key of a session from the shared secret of
+// private and the peer's public key, like libsecret does: HKDF-SHA256
+// without salt and info over the secret padded to the size of the prime.
+func dhSessionKey(private *big.Int, peer []byte) ([]byte, error) {
+	public := new(big.Int).SetBytes(peer)
+	if public.Cmp(big.NewInt(1)) <= 0 || public.Cmp(dhPrime) >= 0 {
+		return nil, errors.New("invalid public key")
+	}
+
+	shared := new(big.Int).Exp(public, private, dhPrime)
+	secret := shared.FillBytes(make([]byte, (dhPrime.BitLen()+7)/8))
+
+	key := make([]byte, 16)
+	_, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, nil), key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Encrypted reports whether secrets are encrypted on the session.
+func (s *Session) Encrypted() bool {
+	return s.key != nil
+}
+
+// Encrypt returns secret ready to be sent over the session, with its value
+// encrypted if the session is.
+func (s *Session) Encrypt(secret Secret) (Secret, error) {
+	secret.Session = s.Path()
+	if s.key == nil {
+		return secret, nil
+	}
+
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	_, err = io.ReadFull(rand.Reader, iv)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	// PKCS #7 padding
+	padding := aes.BlockSize - len(secret.Value)%aes.BlockSize
+	value := make([]byte, len(secret.Value)+padding)
+	copy(value, secret.Value)
+	copy(value[len(secret.Value):], bytes.Repeat([]byte{byte(padding)}, padding))
+
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(value, value)
+	secret.Parameters = iv
+	secret.Value = value
+	return secret, nil
+}
+
+// Decrypt returns the value of secret received over the session.
+func (s *Session) Decrypt(secret *Secret) ([]byte, error) {
+	if s.key == nil {
+		return secret.Value, nil
+	}
+
+	if len(secret.Parameters) != aes.BlockSize || len(secret.Value) == 0 || len(secret.Value)%aes.BlockSize != 0 {
+		return nil, errors.New("malformed encrypted secret")
+	}
+
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, len(secret.Value))
+	cipher.NewCBCDecrypter(block, secret.Parameters).CryptBlocks(value, secret.Value)
+
+	padding := int(value[len(value)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(value[len(value)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("malformed encrypted secret")
+	}
+	return value[:len(value)-padding], nil
+}
+
 // CheckCollectionPath accepts dbus path and returns nil if the path is found
 // in the collection interface (and can be used).
 func (s *SecretService) CheckCollectionPath(path dbus.ObjectPath) error {
@@ -88,22 +287,127 @@ func (s *SecretService) CheckCollectionPath(path dbus.ObjectPath) error {
 	return errors.New("path not found")
 }
 
+// Collections returns the labels of all collections known to the secret
+// service, regardless of whether they are locked.
+func (s *SecretService) Collections() ([]string, error) {
+	val, err := s.object.GetProperty(collectionsInterface)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, ok := val.Value().([]dbus.ObjectPath)
+	if !ok {
+		return nil, fmt.Errorf("unexpected collections property type %s", val.Signature())
+	}
+
+	labels := make([]string, 0, len(paths))
+	for _, path := range paths {
+		label, err := s.Object(serviceName, path).GetProperty(collectionInterface + ".Label")
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, label.Value().(string))
+	}
+
+	return labels, nil
+}
+
+// ReadAlias returns the path of the collection an alias such as "default"
+// refers to. It returns "/" if the alias isn't set.
+func (s *SecretService) ReadAlias(name string) (dbus.ObjectPath, error) {
+	var path dbus.ObjectPath
+	err := s.object.Call(serviceInterface+".ReadAlias", 0, name).Store(&path)
+	if err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// FindCollection returns the collection with the given alias or, failing
+// that, the first one with the given label. ok is false if there is none.
+func (s *SecretService) FindCollection(name string) (collection dbus.BusObject, ok bool, err error) {
+	path, err := s.ReadAlias(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if path != "/" {
+		return s.Object(serviceName, path), true, nil
+	}
+
+	val, err := s.object.GetProperty(collectionsInterface)
+	if err != nil {
+		return nil, false, err
+	}
+
+	paths, ok := val.Value().([]dbus.ObjectPath)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected collections property type %s", val.Signature())
+	}
+
+	for _, path := range paths {
+		obj := s.Object(serviceName, path)
+		label, err := obj.GetProperty(collectionInterface + ".Label")
+		if err != nil {
+			return nil, false, err
+		}
+		if label.Value() == name {
+			return obj, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
 // GetCollection returns a collection from a name.
 func (s *SecretService) GetCollection(name string) dbus.BusObject {
 	return s.Object(serviceName, dbus.ObjectPath(collectionBasePath+name))
 }
 
-// GetLoginCollection decides and returns the dbus collection to be used for login.
+// GetLoginCollection decides and returns the dbus collection to be used for
+// login: the collection the "default" alias refers to, which isn't named
+// "login" on every system, or the collection "login" if the alias isn't set.
 func (s *SecretService) GetLoginCollection() dbus.BusObject {
-	path := dbus.ObjectPath(collectionBasePath + "login")
+	path, err := s.ReadAlias("default")
+	if err == nil && path != "/" {
+		return s.Object(serviceName, path)
+	}
+
+	path = dbus.ObjectPath(collectionBasePath + "login")
 	if err := s.CheckCollectionPath(path); err != nil {
 		path = dbus.ObjectPath(loginCollectionAlias)
 	}
 	return s.Object(serviceName, path)
 }
 
+// CollectionLabel returns the label of collection.
+func (s *SecretService) CollectionLabel(collection dbus.BusObject) (string, error) {
+	label, err := collection.GetProperty(collectionInterface + ".Label")
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := label.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected label property type %s", label.Signature())
+	}
+	return value, nil
+}
+
 // Unlock unlocks a collection.
 func (s *SecretService) Unlock(collection dbus.ObjectPath) error {
+	return s.unlock(collection, true)
+}
+
+// UnlockNoPrompt unlocks collection like Unlock if that's possible without
+// prompting the user, and returns ErrLocked right away otherwise. This keeps
+// background processes from waiting for a prompt no one will answer.
+func (s *SecretService) UnlockNoPrompt(collection dbus.ObjectPath) error {
+	return s.unlock(collection, false)
+}
+
+// unlock unlocks collection, prompting the user if needed and interactive.
+func (s *SecretService) unlock(collection dbus.ObjectPath, interactive bool) error {
 	var unlocked []dbus.ObjectPath
 	var prompt dbus.ObjectPath
 	err := s.object.Call(serviceInterface+".Unlock", 0, []dbus.ObjectPath{collection}).Store(&unlocked, &prompt)
@@ -111,10 +415,18 @@ func (s *SecretService) Unlock(collection dbus.ObjectPath) error {
 		return err
 	}
 
-	_, v, err := s.handlePrompt(prompt)
+	if !interactive && prompt != dbus.ObjectPath("/") {
+		_ = s.DismissPrompt(prompt)
+		return ErrLocked
+	}
+
+	dismissed, v, err := s.handlePrompt(prompt)
 	if err != nil {
 		return err
 	}
+	if dismissed {
+		return ErrPromptDismissed
+	}
 
 	collections := v.Value()
 	switch c := collections.(type) {
@@ -122,6 +434,9 @@ func (s *SecretService) Unlock(collection dbus.ObjectPath) error {
 		unlocked = append(unlocked, c...)
 	}
 
+	if len(unlocked) == 0 {
+		return ErrLocked
+	}
 	if len(unlocked) != 1 || (collection != loginCollectionAlias && unlocked[0] != collection) {
 		return fmt.Errorf("failed to unlock correct collection '%v'", collection)
 	}
@@ -129,6 +444,125 @@ func (s *SecretService) Unlock(collection dbus.ObjectPath) error {
 	return nil
 }
 
+// Lock locks collection, so its secrets can only be read again once it's
+// unlocked, which usually prompts the user for the password.
+func (s *SecretService) Lock(collection dbus.ObjectPath) error {
+	var locked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := s.object.Call(serviceInterface+".Lock", 0, []dbus.ObjectPath{collection}).Store(&locked, &prompt)
+	if err != nil {
+		return err
+	}
+
+	dismissed, _, err := s.handlePrompt(prompt)
+	if err != nil {
+		return err
+	}
+	if dismissed {
+		return ErrPromptDismissed
+	}
+
+	return nil
+}
+
+// PromptCompletion is the outcome of a prompt.
+type PromptCompletion struct {
+	// Dismissed reports whether the user dismissed the prompt.
+	Dismissed bool
+	// Result is the result of the prompted operation, e.g. the objects
+	// unlocked by an unlock prompt.
+	Result dbus.Variant
+}
+
+// UnlockWithPrompt requests collection to be unlocked like Unlock, but leaves
+// the prompt to the caller instead of showing it and waiting for the user.
+// It returns the path of the prompt, "/" if none is needed, and a channel
+// receiving the completion of the prompt, e.g. to show it with Prompt along
+// the caller's own window, or to log it. A prompt which isn't going to be
+// shown should be dismissed with DismissPrompt, which completes it. The
+// channel is closed without a completion if the connection is closed first.
+func (s *SecretService) UnlockWithPrompt(collection dbus.ObjectPath) (dbus.ObjectPath, <-chan PromptCompletion, error) {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := s.object.Call(serviceInterface+".Unlock", 0, []dbus.ObjectPath{collection}).Store(&unlocked, &prompt)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if prompt == dbus.ObjectPath("/") {
+		completed := make(chan PromptCompletion, 1)
+		completed <- PromptCompletion{Result: dbus.MakeVariant(unlocked)}
+		close(completed)
+		return prompt, completed, nil
+	}
+
+	completed, _, err := s.watchPrompt(prompt)
+	if err != nil {
+		return "", nil, err
+	}
+	return prompt, completed, nil
+}
+
+// Prompt shows prompt to the user, as a transient window of the window with
+// the given platform specific ID, if not empty.
+func (s *SecretService) Prompt(prompt dbus.ObjectPath, windowID string) error {
+	return s.Object(serviceName, prompt).Call(promptInterface+".Prompt", 0, windowID).Err
+}
+
+// DismissPrompt dismisses prompt, completing it without the operation.
+func (s *SecretService) DismissPrompt(prompt dbus.ObjectPath) error {
+	return s.Object(serviceName, prompt).Call(promptInterface+".Dismiss", 0).Err
+}
+
+// watchPrompt returns a channel receiving the completion of prompt, and a
+// function to stop watching it. The channel is closed once the prompt
+// completed, the watch is stopped or the connection is closed.
+func (s *SecretService) watchPrompt(prompt dbus.ObjectPath) (<-chan PromptCompletion, func(), error) {
+	options := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(promptInterface),
+	}
+	err := s.AddMatchSignal(options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signals := make(chan *dbus.Signal, 1)
+	s.Signal(signals)
+
+	completed := make(chan PromptCompletion, 1)
+	stop := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		defer close(completed)
+		defer func() {
+			s.RemoveSignal(signals)
+			_ = s.RemoveMatchSignal(options...)
+		}()
+
+		for {
+			select {
+			case signal, ok := <-signals:
+				if !ok {
+					return
+				}
+				if signal.Path != prompt || signal.Name != promptInterface+".Completed" || len(signal.Body) != 2 {
+					continue
+				}
+				dismissed, _ := signal.Body[0].(bool)
+				result, _ := signal.Body[1].(dbus.Variant)
+				completed <- PromptCompletion{Dismissed: dismissed, Result: result}
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return completed, func() { once.Do(func() { close(stop) }) }, nil
+}
+
 // Close closes a secret service dbus session.
 func (s *SecretService) Close(session dbus.BusObject) error {
 	return session.Call(sessionInterface+".Close", 0).Err
@@ -151,8 +585,9 @@ func (s *SecretService) CreateCollection(label string) (dbus.BusObject, error) {
 		return nil, err
 	}
 
-	if v.String() != "" {
-		collection = dbus.ObjectPath(v.String())
+	// the path is only returned by the prompt if one was needed
+	if path, ok := v.Value().(dbus.ObjectPath); ok {
+		collection = path
 	}
 
 	return s.Object(serviceName, collection), nil
@@ -181,38 +616,142 @@ func (s *SecretService) CreateItem(collection dbus.BusObject, label string, attr
 	return nil
 }
 
+// deleteBatch is the maximum number of Delete calls DeleteMany has in flight.
+const deleteBatch = 64
+
+// DeleteMany deletes the given items, sending the Delete calls in batches
+// instead of waiting for each reply before sending the next call, which
+// saves most of the round trips for large collections. The Secret Service
+// has no bulk delete. Prompts are handled one after another. It returns the
+// number of deleted items and stops at the first batch with an error, whose
+// other items may have been deleted already.
+func (s *SecretService) DeleteMany(items []dbus.ObjectPath) (int, error) {
+	deleted := 0
+	for len(items) > 0 {
+		n := deleteBatch
+		if len(items) < n {
+			n = len(items)
+		}
+
+		calls := make([]*dbus.Call, n)
+		for i, item := range items[:n] {
+			calls[i] = s.Object(serviceName, item).Go(itemInterface+".Delete", 0, nil)
+		}
+		items = items[n:]
+
+		var firstErr error
+		for _, call := range calls {
+			var prompt dbus.ObjectPath
+			err := (<-call.Done).Store(&prompt)
+			if err == nil {
+				_, _, err = s.handlePrompt(prompt)
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			deleted++
+		}
+		if firstErr != nil {
+			return deleted, firstErr
+		}
+	}
+	return deleted, nil
+}
+
+// SetSecret replaces the secret of an existing item.
+func (s *SecretService) SetSecret(itemPath dbus.ObjectPath, secret Secret) error {
+	return s.Object(serviceName, itemPath).Call(itemInterface+".SetSecret", 0, secret).Err
+}
+
+// SetLabel changes the label of an item.
+func (s *SecretService) SetLabel(itemPath dbus.ObjectPath, label string) error {
+	return s.Object(serviceName, itemPath).SetProperty(itemInterface+".Label", dbus.MakeVariant(label))
+}
+
+// SetAttributes replaces the attributes of an item.
+func (s *SecretService) SetAttributes(itemPath dbus.ObjectPath, attributes map[string]string) error {
+	return s.Object(serviceName, itemPath).SetProperty(itemInterface+".Attributes", dbus.MakeVariant(attributes))
+}
+
+// GetAttributes returns the attributes of an item.
+func (s *SecretService) GetAttributes(itemPath dbus.ObjectPath) (map[string]string, error) {
+	val, err := s.Object(serviceName, itemPath).GetProperty(itemInterface + ".Attributes")
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, ok := val.Value().(map[string]string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected attributes property type %s", val.Signature())
+	}
+
+	return attributes, nil
+}
+
+// GetItems returns all items of a collection.
+func (s *SecretService) GetItems(collection dbus.BusObject) ([]dbus.ObjectPath, error) {
+	val, err := collection.GetProperty(collectionInterface + ".Items")
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := val.Value().([]dbus.ObjectPath)
+	if !ok {
+		return nil, fmt.Errorf("unexpected items property type %s", val.Signature())
+	}
+
+	return items, nil
+}
+
+// GetItemInfo returns the metadata of an item without reading its secret.
+func (s *SecretService) GetItemInfo(itemPath dbus.ObjectPath) (*ItemInfo, error) {
+	var properties map[string]dbus.Variant
+	err := s.Object(serviceName, itemPath).Call("org.freedesktop.DBus.Properties.GetAll", 0, itemInterface).Store(&properties)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ItemInfo{}
+	if label, ok := properties["Label"].Value().(string); ok {
+		info.Label = label
+	}
+	if attributes, ok := properties["Attributes"].Value().(map[string]string); ok {
+		info.Attributes = attributes
+	}
+	if created, ok := properties["Created"].Value().(uint64); ok {
+		info.Created = time.Unix(int64(created), 0)
+	}
+	if modified, ok := properties["Modified"].Value().(uint64); ok {
+		info.Modified = time.Unix(int64(modified), 0)
+	}
+
+	return info, nil
+}
+
 // handlePrompt checks if a prompt should be handles and handles it by
 // triggering the prompt and waiting for the Secret service daemon to display
 // the prompt to the user.
 func (s *SecretService) handlePrompt(prompt dbus.ObjectPath) (bool, dbus.Variant, error) {
 	if prompt != dbus.ObjectPath("/") {
-		err := s.AddMatchSignal(dbus.WithMatchObjectPath(prompt),
-			dbus.WithMatchInterface(promptInterface),
-		)
+		completed, stop, err := s.watchPrompt(prompt)
 		if err != nil {
 			return false, dbus.MakeVariant(""), err
 		}
+		defer stop()
 
-		defer func(s *SecretService, options ...dbus.MatchOption) {
-			_ = s.RemoveMatchSignal(options...)
-		}(s, dbus.WithMatchObjectPath(prompt), dbus.WithMatchInterface(promptInterface))
-
-		promptSignal := make(chan *dbus.Signal, 1)
-		s.Signal(promptSignal)
-
-		err = s.Object(serviceName, prompt).Call(promptInterface+".Prompt", 0, "").Err
+		err = s.Prompt(prompt, "")
 		if err != nil {
 			return false, dbus.MakeVariant(""), err
 		}
 
-		signal := <-promptSignal
-		switch signal.Name {
-		case promptInterface + ".Completed":
-			dismissed := signal.Body[0].(bool)
-			result := signal.Body[1].(dbus.Variant)
-			return dismissed, result, nil
+		c, ok := <-completed
+		if !ok {
+			return false, dbus.MakeVariant(""), errors.New("connection closed while waiting for the prompt")
 		}
-
+		return c.Dismissed, c.Result, nil
 	}
 
 	return false, dbus.MakeVariant(""), nil
@@ -233,6 +772,9 @@ func (s *SecretService) SearchItems(collection dbus.BusObject, search interface{
 func (s *SecretService) GetSecret(itemPath dbus.ObjectPath, session dbus.ObjectPath) (*Secret, error) {
 	var secret Secret
 	err := s.Object(serviceName, itemPath).Call(itemInterface+".GetSecret", 0, session).Store(&secret)
+	if e, ok := err.(dbus.Error); ok && e.Name == isLockedError {
+		return nil, ErrLocked
+	}
 	if err != nil {
 		return nil, err
 	}
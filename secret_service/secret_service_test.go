@@ -0,0 +1,570 @@
+package ss
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	dbus "github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// startBus starts a private dbus-daemon and returns a connection to it for
+// the fake secret service and one for the client under test.
+func startBus(t testing.TB) (*dbus.Conn, *dbus.Conn) {
+	t.Helper()
+
+	path, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+
+	cmd := exec.Command(path, "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	address = strings.TrimSpace(address)
+
+	connect := func() *dbus.Conn {
+		conn, err := dbus.Connect(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn
+	}
+
+	return connect(), connect()
+}
+
+// fakeService exports a minimal secret service with the given collection
+// labels, keyed by collection name, on conn.
+func fakeService(t *testing.T, conn *dbus.Conn, collections map[string]string) {
+	t.Helper()
+
+	paths := []dbus.ObjectPath{}
+	for name, label := range collections {
+		path := dbus.ObjectPath(collectionBasePath + name)
+		paths = append(paths, path)
+		_, err := prop.Export(conn, path, prop.Map{
+			collectionInterface: {
+				"Label":  {Value: label},
+				"Locked": {Value: name != "login"},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := prop.Export(conn, servicePath, prop.Map{
+		serviceInterface: {
+			"Collections": {Value: paths},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.Export(aliases{"default": collectionBasePath + "login"}, servicePath, serviceInterface)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := conn.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", serviceName, err)
+	}
+}
+
+// aliases implements ReadAlias of the fake secret service.
+type aliases map[string]dbus.ObjectPath
+
+func (a aliases) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	if path, ok := a[name]; ok {
+		return path, nil
+	}
+	return "/", nil
+}
+
+// TestCollections tests listing the collections of a secret service.
+func TestCollections(t *testing.T) {
+	server, client := startBus(t)
+	fakeService(t, server, map[string]string{
+		"login": "Login",
+		"work":  "Work",
+	})
+
+	svc := NewSecretServiceWithConn(client)
+	labels, err := svc.Collections()
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	sort.Strings(labels)
+	if strings.Join(labels, ",") != "Login,Work" {
+		t.Errorf("Expected collections Login and Work, got %v", labels)
+	}
+}
+
+// TestFindCollection tests resolving collections by alias and label.
+func TestFindCollection(t *testing.T) {
+	server, client := startBus(t)
+	fakeService(t, server, map[string]string{
+		"login": "Login",
+		"work":  "Work",
+	})
+
+	svc := NewSecretServiceWithConn(client)
+	for name, path := range map[string]dbus.ObjectPath{
+		"default": collectionBasePath + "login",
+		"Work":    collectionBasePath + "work",
+	} {
+		collection, ok, err := svc.FindCollection(name)
+		if err != nil || !ok {
+			t.Fatalf("Expected collection %s to be found, got %t, %v", name, ok, err)
+		}
+		if collection.Path() != path {
+			t.Errorf("Expected collection %s at %s, got %s", name, path, collection.Path())
+		}
+	}
+
+	_, ok, err := svc.FindCollection("missing")
+	if err != nil || ok {
+		t.Errorf("Expected no collection, got %t, %v", ok, err)
+	}
+}
+
+// TestGetLoginCollection tests resolving the default collection through the
+// "default" alias, falling back to the collection "login".
+func TestGetLoginCollection(t *testing.T) {
+	server, client := startBus(t)
+	fakeService(t, server, map[string]string{
+		"login": "Login",
+		"work":  "Work",
+	})
+
+	svc := NewSecretServiceWithConn(client)
+	for _, c := range []struct {
+		alias, path dbus.ObjectPath
+	}{
+		{collectionBasePath + "work", collectionBasePath + "work"},
+		{"", collectionBasePath + "login"},
+	} {
+		alias, path := c.alias, c.path
+		a := aliases{}
+		if alias != "" {
+			a["default"] = alias
+		}
+		err := server.Export(a, servicePath, serviceInterface)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		collection := svc.GetLoginCollection()
+		if collection.Path() != path {
+			t.Errorf("Expected collection %s for alias %q, got %s", path, alias, collection.Path())
+		}
+	}
+
+	label, err := svc.CollectionLabel(svc.GetLoginCollection())
+	if err != nil || label != "Login" {
+		t.Errorf("Expected label Login, got %q, %v", label, err)
+	}
+}
+
+// locked implements Unlock of a fake secret service whose prompt completes
+// without unlocking anything, and GetSecret of its items.
+type locked struct {
+	conn      *dbus.Conn
+	dismissed bool
+}
+
+func (l locked) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	return []dbus.ObjectPath{}, "/org/freedesktop/secrets/prompt/p1", nil
+}
+
+func (l locked) Prompt(windowID string) *dbus.Error {
+	err := l.conn.Emit("/org/freedesktop/secrets/prompt/p1", promptInterface+".Completed",
+		l.dismissed, dbus.MakeVariant([]dbus.ObjectPath{}))
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (l locked) Dismiss() *dbus.Error {
+	return nil
+}
+
+func (l locked) GetSecret(session dbus.ObjectPath) (Secret, *dbus.Error) {
+	return Secret{}, &dbus.Error{Name: isLockedError}
+}
+
+// TestLocked tests the errors returned for collections and items which stay
+// locked.
+func TestLocked(t *testing.T) {
+	for _, dismissed := range []bool{false, true} {
+		server, client := startBus(t)
+		l := locked{conn: server, dismissed: dismissed}
+		for path, iface := range map[dbus.ObjectPath]string{
+			servicePath:                          serviceInterface,
+			"/org/freedesktop/secrets/prompt/p1": promptInterface,
+			collectionBasePath + "login/1":       itemInterface,
+		} {
+			if err := server.Export(l, path, iface); err != nil {
+				t.Fatal(err)
+			}
+		}
+		reply, err := server.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+		if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+			t.Fatalf("failed to own %s: %v", serviceName, err)
+		}
+
+		svc := NewSecretServiceWithConn(client)
+		expected := ErrLocked
+		if dismissed {
+			expected = ErrPromptDismissed
+		}
+		err = svc.Unlock(collectionBasePath + "login")
+		if err != expected {
+			t.Errorf("Expected error %s, got %s", expected, err)
+		}
+
+		// without showing the prompt, which would report the dismissal
+		err = svc.UnlockNoPrompt(collectionBasePath + "login")
+		if err != ErrLocked {
+			t.Errorf("Expected error %s, got %s", ErrLocked, err)
+		}
+
+		_, err = svc.GetSecret(collectionBasePath+"login/1", "/")
+		if err != ErrLocked {
+			t.Errorf("Expected error %s, got %s", ErrLocked, err)
+		}
+	}
+}
+
+// TestUnlockWithPrompt tests leaving the unlock prompt to the caller.
+func TestUnlockWithPrompt(t *testing.T) {
+	server, client := startBus(t)
+	l := locked{conn: server, dismissed: true}
+	for path, iface := range map[dbus.ObjectPath]string{
+		servicePath:                          serviceInterface,
+		"/org/freedesktop/secrets/prompt/p1": promptInterface,
+	} {
+		if err := server.Export(l, path, iface); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reply, err := server.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", serviceName, err)
+	}
+
+	svc := NewSecretServiceWithConn(client)
+	prompt, completed, err := svc.UnlockWithPrompt(collectionBasePath + "login")
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if prompt != "/org/freedesktop/secrets/prompt/p1" {
+		t.Errorf("Expected the prompt path, got %s", prompt)
+	}
+
+	select {
+	case <-completed:
+		t.Fatalf("Expected the prompt not to complete before it's shown")
+	default:
+	}
+
+	err = svc.Prompt(prompt, "")
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	c, ok := <-completed
+	if !ok || !c.Dismissed {
+		t.Errorf("Expected the dismissed completion, got %+v, %t", c, ok)
+	}
+}
+
+// encrypted implements OpenSession of a fake secret service supporting the
+// dh-ietf1024-sha256-aes128-cbc-pkcs7 algorithm, and GetSecret and SetSecret
+// of a single item stored unencrypted in value.
+type encrypted struct {
+	mu      sync.Mutex
+	session *Session
+	value   []byte
+}
+
+func (e *encrypted) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if algorithm != algorithmDH {
+		return dbus.Variant{}, "", &dbus.Error{Name: notSupportedError}
+	}
+
+	private, public, err := dhKeyPair()
+	if err != nil {
+		return dbus.Variant{}, "", dbus.MakeFailedError(err)
+	}
+	e.session.key, err = dhSessionKey(private, input.Value().([]byte))
+	if err != nil {
+		return dbus.Variant{}, "", dbus.MakeFailedError(err)
+	}
+	return dbus.MakeVariant(public.Bytes()), e.session.Path(), nil
+}
+
+func (e *encrypted) SetSecret(secret Secret) *dbus.Error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	value, err := e.session.Decrypt(&secret)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	e.value = value
+	return nil
+}
+
+func (e *encrypted) GetSecret(session dbus.ObjectPath) (Secret, *dbus.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	secret, err := e.session.Encrypt(Secret{Value: e.value, ContentType: "text/plain"})
+	if err != nil {
+		return Secret{}, dbus.MakeFailedError(err)
+	}
+	return secret, nil
+}
+
+// stored returns the unencrypted value of the item.
+func (e *encrypted) stored() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return string(e.value)
+}
+
+// TestEncryptedSession tests storing and reading a secret over a session
+// encrypted with a key negotiated by Diffie-Hellman key exchange.
+func TestEncryptedSession(t *testing.T) {
+	server, client := startBus(t)
+	e := &encrypted{
+		session: &Session{BusObject: server.Object(serviceName, "/org/freedesktop/secrets/session/s1")},
+	}
+	item := dbus.ObjectPath(collectionBasePath + "login/1")
+	for path, iface := range map[dbus.ObjectPath]string{
+		servicePath: serviceInterface,
+		item:        itemInterface,
+	} {
+		if err := server.Export(e, path, iface); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reply, err := server.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", serviceName, err)
+	}
+
+	svc := NewSecretServiceWithConn(client)
+	session, err := svc.OpenEncryptedSession()
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if !session.Encrypted() {
+		t.Fatalf("Expected an encrypted session")
+	}
+
+	secret, err := session.Encrypt(NewSecret("", "test password"))
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if string(secret.Value) == "test password" {
+		t.Errorf("Expected the secret to be encrypted")
+	}
+
+	err = svc.SetSecret(item, secret)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if stored := e.stored(); stored != "test password" {
+		t.Errorf("Expected the service to store %q, got %q", "test password", stored)
+	}
+
+	received, err := svc.GetSecret(item, session.Path())
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	value, err := session.Decrypt(received)
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+	if string(value) != "test password" {
+		t.Errorf("Expected secret %q, got %q", "test password", value)
+	}
+}
+
+// deletable implements Delete of fake items, counting the deleted ones and
+// failing for the item at failing.
+type deletable struct {
+	mu      sync.Mutex
+	deleted int
+	failing dbus.ObjectPath
+	path    dbus.ObjectPath
+}
+
+func (d *deletable) Delete() (dbus.ObjectPath, *dbus.Error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.path == d.failing {
+		return "", dbus.MakeFailedError(errors.New("cannot delete"))
+	}
+	d.deleted++
+	return "/", nil
+}
+
+// fakeItems exports n deletable items on conn and returns their paths and a
+// function counting the deleted ones.
+func fakeItems(tb testing.TB, conn *dbus.Conn, n int, failing dbus.ObjectPath) ([]dbus.ObjectPath, func() int) {
+	tb.Helper()
+
+	counters := []*deletable{}
+	items := make([]dbus.ObjectPath, n)
+	for i := range items {
+		items[i] = dbus.ObjectPath(fmt.Sprintf("%slogin/%d", collectionBasePath, i+1))
+		d := &deletable{failing: failing, path: items[i]}
+		counters = append(counters, d)
+		if err := conn.Export(d, items[i], itemInterface); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	reply, err := conn.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		tb.Fatalf("failed to own %s: %v", serviceName, err)
+	}
+
+	return items, func() int {
+		deleted := 0
+		for _, d := range counters {
+			d.mu.Lock()
+			deleted += d.deleted
+			d.mu.Unlock()
+		}
+		return deleted
+	}
+}
+
+// TestDeleteMany tests deleting items in batches.
+func TestDeleteMany(t *testing.T) {
+	server, client := startBus(t)
+	items, deleted := fakeItems(t, server, 150, collectionBasePath+"login/100")
+
+	svc := NewSecretServiceWithConn(client)
+	n, err := svc.DeleteMany(items)
+	if err == nil {
+		t.Errorf("Expected the failing item to be reported")
+	}
+	// the third batch isn't sent after the second failed
+	if n != 2*deleteBatch-1 || deleted() != n {
+		t.Errorf("Expected %d items deleted, got %d and %d", 2*deleteBatch-1, n, deleted())
+	}
+
+	n, err = svc.DeleteMany(items[:deleteBatch])
+	if err != nil || n != deleteBatch {
+		t.Errorf("Expected %d items deleted, got %d, %v", deleteBatch, n, err)
+	}
+}
+
+// benchmarkDelete deletes 1000 fake items per iteration with del.
+func benchmarkDelete(b *testing.B, del func(svc *SecretService, items []dbus.ObjectPath) error) {
+	server, client := startBus(b)
+	items, _ := fakeItems(b, server, 1000, "")
+	svc := NewSecretServiceWithConn(client)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := del(svc, items); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDelete deletes 1000 items one round trip after another.
+func BenchmarkDelete(b *testing.B) {
+	benchmarkDelete(b, func(svc *SecretService, items []dbus.ObjectPath) error {
+		for _, item := range items {
+			if err := svc.Delete(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BenchmarkDeleteMany deletes 1000 items in batches.
+func BenchmarkDeleteMany(b *testing.B) {
+	benchmarkDelete(b, func(svc *SecretService, items []dbus.ObjectPath) error {
+		_, err := svc.DeleteMany(items)
+		return err
+	})
+}
+
+// lockable implements Lock of a fake secret service, recording the locked
+// objects.
+type lockable struct {
+	mu     sync.Mutex
+	locked []dbus.ObjectPath
+}
+
+func (l *lockable) Lock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.locked = append(l.locked, objects...)
+	return objects, "/", nil
+}
+
+// TestLock tests locking a collection.
+func TestLock(t *testing.T) {
+	server, client := startBus(t)
+	l := &lockable{}
+	if err := server.Export(l, servicePath, serviceInterface); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := server.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", serviceName, err)
+	}
+
+	svc := NewSecretServiceWithConn(client)
+	err = svc.Lock(collectionBasePath + "login")
+	if err != nil {
+		t.Fatalf("Should not fail, got: %s", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.locked) != 1 || l.locked[0] != collectionBasePath+"login" {
+		t.Errorf("Expected the login collection to be locked, got %v", l.locked)
+	}
+}